@@ -0,0 +1,269 @@
+package cnfgfile
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"regexp"
+	"strconv"
+	"strings"
+
+	toml "github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ByteSize units. The IEC (binary) units are powers of 1024, the SI (decimal) units are powers of 1000.
+const (
+	Byte ByteSize = 1
+	KiB           = Byte << 10
+	MiB           = KiB << 10
+	GiB           = MiB << 10
+	TiB           = GiB << 10
+	PiB           = TiB << 10
+	EiB           = PiB << 10
+	KB            = Byte * 1000
+	MB            = KB * 1000
+	GB            = MB * 1000
+	TB            = GB * 1000
+	PB            = TB * 1000
+	EB            = PB * 1000
+)
+
+// ErrInvalidByteSize is returned when a byte size cannot be parsed.
+var ErrInvalidByteSize = errors.New("invalid byte size")
+
+// ByteSize is useful if you need to load a size limit from a config file into your application.
+// Works like Duration: it unmarshals from strings and numbers in every supported format.
+// Accepts plain integers (bytes), IEC units (512KiB), SI units (10MB) and single letter
+// units, which are binary (1.5G is 1.5GiB). Units are case-insensitive.
+type ByteSize uint64
+
+// byteUnits maps every accepted (lower-case) unit to its size.
+var byteUnits = map[string]ByteSize{ //nolint:gochecknoglobals
+	"": Byte, "b": Byte,
+	"k": KiB, "ki": KiB, "kib": KiB, "kb": KB,
+	"m": MiB, "mi": MiB, "mib": MiB, "mb": MB,
+	"g": GiB, "gi": GiB, "gib": GiB, "gb": GB,
+	"t": TiB, "ti": TiB, "tib": TiB, "tb": TB,
+	"p": PiB, "pi": PiB, "pib": PiB, "pb": PB,
+	"e": EiB, "ei": EiB, "eib": EiB, "eb": EB,
+}
+
+// byteNames is the order String() tries units in, largest first.
+var byteNames = []struct { //nolint:gochecknoglobals
+	name string
+	size ByteSize
+}{
+	{"EiB", EiB}, {"EB", EB}, {"PiB", PiB}, {"PB", PB}, {"TiB", TiB}, {"TB", TB},
+	{"GiB", GiB}, {"GB", GB}, {"MiB", MiB}, {"MB", MB}, {"KiB", KiB}, {"KB", KB},
+}
+
+// byteSizePart matches a number and an optional unit.
+var byteSizePart = regexp.MustCompile(`^([0-9]*\.?[0-9]+)\s*([a-zA-Z]*)$`)
+
+// ParseByteSize parses a byte size string, ie. 1024, 512KiB, 10MB or 1.5G.
+func ParseByteSize(str string) (ByteSize, error) {
+	match := byteSizePart.FindStringSubmatch(strings.TrimSpace(str))
+	if match == nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidByteSize, str)
+	}
+
+	unit, ok := byteUnits[strings.ToLower(match[2])]
+	if !ok {
+		return 0, fmt.Errorf("%w: unknown unit: %s", ErrInvalidByteSize, str)
+	}
+
+	whole, frac, _ := strings.Cut(match[1], ".")
+
+	size, err := strconv.ParseUint("0"+whole, 10, 64) //nolint:mnd
+	if err != nil || size > math.MaxUint64/uint64(unit) {
+		return 0, fmt.Errorf("%w: too large: %s", ErrInvalidByteSize, str)
+	}
+
+	total, carry := bits.Add64(size*uint64(unit), uint64(scaleFraction(frac, unit)), 0)
+	if carry != 0 {
+		return 0, fmt.Errorf("%w: too large: %s", ErrInvalidByteSize, str)
+	}
+
+	return ByteSize(total), nil
+}
+
+// parseByteNumber parses a number that ParseByteSize does not understand, ie. one with an exponent like 1e6.
+func parseByteNumber(str string) (ByteSize, error) {
+	num, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidByteSize, str)
+	}
+
+	return sizeFromFloat(num)
+}
+
+// sizeFromFloat converts a number of bytes into a ByteSize. Returns an error if it's negative, too large or not finite.
+func sizeFromFloat(num float64) (ByteSize, error) {
+	// float64(math.MaxUint64) is 2^64, so it must be excluded too.
+	if math.IsNaN(num) || num < 0 || num >= math.MaxUint64 {
+		return 0, fmt.Errorf("%w: out of range: %v", ErrInvalidByteSize, num)
+	}
+
+	return ByteSize(num), nil
+}
+
+// scaleFraction returns the number of bytes in a fraction of a unit, ie. "5" and KiB is 512.
+// The math is done with integers, so 1.5G is exactly 1.5GiB.
+func scaleFraction(frac string, unit ByteSize) ByteSize {
+	const maxDigits = 19 // 10^19 is the largest power of ten that fits in a uint64.
+
+	if len(frac) > maxDigits {
+		frac = frac[:maxDigits]
+	}
+
+	numerator, _ := strconv.ParseUint("0"+frac, 10, 64) //nolint:mnd
+	denominator := uint64(math.Pow10(len(frac)))
+	// unit * numerator / denominator, without overflowing. hi is always less than denominator.
+	hi, lo := bits.Mul64(uint64(unit), numerator)
+	quo, _ := bits.Div64(hi, lo, denominator)
+
+	return ByteSize(quo)
+}
+
+// String returns the most compact representation of a byte size that is exact, ie. 512KiB or 10MB.
+func (b ByteSize) String() string {
+	output := strconv.FormatUint(uint64(b), 10) + "B" //nolint:mnd
+
+	for _, unit := range byteNames {
+		if b == 0 || b%unit.size != 0 {
+			continue
+		}
+
+		if str := strconv.FormatUint(uint64(b/unit.size), 10) + unit.name; len(str) < len(output) { //nolint:mnd
+			output = str
+		}
+	}
+
+	return output
+}
+
+// UnmarshalText parses a byte size from a config file string, ie. 512KiB.
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	size, err := ParseByteSize(string(text))
+	if err != nil {
+		return fmt.Errorf("parsing byte size '%s': %w", text, err)
+	}
+
+	*b = size
+
+	return nil
+}
+
+// UnmarshalJSON parses a byte size from a JSON string, ie. "10MB", or a JSON number, ie. 1024 or 1e6.
+// A null does not change the byte size.
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	if str, err := strconv.Unquote(string(data)); err == nil {
+		return b.UnmarshalText([]byte(str))
+	}
+
+	size, err := ParseByteSize(string(data))
+	if err != nil {
+		if size, err = parseByteNumber(string(data)); err != nil {
+			return fmt.Errorf("parsing byte size '%s': %w", data, err)
+		}
+	}
+
+	*b = size
+
+	return nil
+}
+
+// UnmarshalYAML parses a byte size from a YAML string, ie. 10MB, or a YAML number, ie. 1024 or 1e6.
+func (b *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("%w: yaml line %d: must be a string or number", ErrInvalidByteSize, node.Line)
+	}
+
+	if tag := node.ShortTag(); tag != "!!int" && tag != "!!float" {
+		return b.UnmarshalText([]byte(node.Value))
+	}
+
+	size, err := ParseByteSize(node.Value)
+	if err != nil {
+		if size, err = parseByteNumber(node.Value); err != nil {
+			return fmt.Errorf("parsing byte size '%s': %w", node.Value, err)
+		}
+	}
+
+	*b = size
+
+	return nil
+}
+
+// UnmarshalTOML parses a byte size from a TOML string, integer or float.
+func (b *ByteSize) UnmarshalTOML(data interface{}) error {
+	switch val := data.(type) {
+	case string:
+		return b.UnmarshalText([]byte(val))
+	case int64:
+		if val < 0 {
+			return fmt.Errorf("%w: negative: %d", ErrInvalidByteSize, val)
+		}
+
+		*b = ByteSize(val)
+	case float64:
+		size, err := sizeFromFloat(val)
+		if err != nil {
+			return err
+		}
+
+		*b = size
+	default:
+		return fmt.Errorf("%w: toml type %T: must be a string or number", ErrInvalidByteSize, data)
+	}
+
+	return nil
+}
+
+// UnmarshalXMLAttr parses a byte size from an XML attribute.
+func (b *ByteSize) UnmarshalXMLAttr(attr xml.Attr) error {
+	return b.UnmarshalText([]byte(attr.Value))
+}
+
+// MarshalText returns the string representation of a ByteSize. ie. 512KiB.
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// MarshalJSON returns the string representation of a ByteSize for JSON. ie. "512KiB".
+func (b ByteSize) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + b.String() + `"`), nil
+}
+
+// MarshalYAML returns the string representation of a ByteSize for YAML. ie. 512KiB.
+func (b ByteSize) MarshalYAML() (interface{}, error) {
+	return b.String(), nil
+}
+
+// MarshalXMLAttr returns the string representation of a ByteSize as an XML attribute.
+func (b ByteSize) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	return xml.Attr{Name: name, Value: b.String()}, nil
+}
+
+// Make sure our type satisfies the interfaces it's for.
+var (
+	_ encoding.TextUnmarshaler = (*ByteSize)(nil)
+	_ encoding.TextMarshaler   = (*ByteSize)(nil)
+	_ json.Marshaler           = (*ByteSize)(nil)
+	_ json.Unmarshaler         = (*ByteSize)(nil)
+	_ yaml.Marshaler           = (*ByteSize)(nil)
+	_ yaml.Unmarshaler         = (*ByteSize)(nil)
+	_ toml.Unmarshaler         = (*ByteSize)(nil)
+	_ xml.MarshalerAttr        = (*ByteSize)(nil)
+	_ xml.UnmarshalerAttr      = (*ByteSize)(nil)
+	_ fmt.Stringer             = (*ByteSize)(nil)
+)
@@ -0,0 +1,143 @@
+package cnfgfile_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseByteSize(t *testing.T) {
+	t.Parallel()
+
+	for input, expect := range map[string]cnfgfile.ByteSize{
+		"0":      0,
+		"1024":   cnfgfile.KiB,
+		"512KiB": 512 * cnfgfile.KiB,
+		"512kib": 512 * cnfgfile.KiB,
+		"10MB":   10 * cnfgfile.MB,
+		"1.5G":   cnfgfile.GiB + 512*cnfgfile.MiB,
+		"1.5 kb": 1500,
+		"2t":     2 * cnfgfile.TiB,
+		"100B":   100,
+		"1EiB":   cnfgfile.EiB,
+	} {
+		size, err := cnfgfile.ParseByteSize(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, expect, size, input)
+	}
+
+	for _, input := range []string{"", "KiB", "-1", "1XB", "1.2.3MB", "99999999999EiB", "18.5EB"} {
+		_, err := cnfgfile.ParseByteSize(input)
+		require.ErrorIs(t, err, cnfgfile.ErrInvalidByteSize, input)
+	}
+}
+
+func TestByteSizeString(t *testing.T) {
+	t.Parallel()
+
+	for expect, size := range map[string]cnfgfile.ByteSize{
+		"0B":     0,
+		"100B":   100,
+		"1536B":  1536,
+		"1KiB":   cnfgfile.KiB,
+		"1KB":    cnfgfile.KB,
+		"1024KB": 1000 * cnfgfile.KiB,
+		"512KiB": 512 * cnfgfile.KiB,
+		"10MB":   10 * cnfgfile.MB,
+		"3GiB":   3 * cnfgfile.GiB,
+		"1EiB":   cnfgfile.EiB,
+	} {
+		assert.Equal(t, expect, size.String())
+
+		parsed, err := cnfgfile.ParseByteSize(expect)
+		require.NoError(t, err, expect)
+		assert.Equal(t, size, parsed, "the string must round trip")
+	}
+}
+
+type byteSizeStruct struct {
+	XMLName xml.Name          `json:"-"    toml:"-"    xml:"config"    yaml:"-"`
+	Attr    cnfgfile.ByteSize `json:"attr" toml:"attr" xml:"attr,attr" yaml:"attr"`
+	Elem    cnfgfile.ByteSize `json:"elem" toml:"elem" xml:"elem"      yaml:"elem"`
+}
+
+func TestByteSizeFormats(t *testing.T) {
+	t.Parallel()
+
+	for name, input := range map[string]string{
+		"json": `{"attr": 2048, "elem": "1.5G"}`,
+		"toml": "attr = 2048\nelem = \"1.5G\"\n",
+		"yaml": "attr: 2048\nelem: 1.5G\n",
+		"xml":  `<config attr="2048"><elem>1.5G</elem></config>`,
+	} {
+		config := byteSizeStruct{}
+		require.NoError(t, unmarshalFormat(name, []byte(input), &config), name)
+		assert.Equal(t, 2*cnfgfile.KiB, config.Attr, name)
+		assert.Equal(t, 1536*cnfgfile.MiB, config.Elem, name)
+
+		buf := bytes.Buffer{}
+		require.NoError(t, marshalFormat(name, &buf, config), name)
+		assert.Contains(t, buf.String(), "2KiB", name)
+		assert.Contains(t, buf.String(), "1536MiB", name)
+
+		output := byteSizeStruct{}
+		require.NoError(t, unmarshalFormat(name, buf.Bytes(), &output), name)
+		assert.Equal(t, config.Attr, output.Attr, name)
+		assert.Equal(t, config.Elem, output.Elem, name)
+	}
+}
+
+func TestByteSizeNumbers(t *testing.T) {
+	t.Parallel()
+
+	var size cnfgfile.ByteSize
+	require.NoError(t, size.UnmarshalJSON([]byte("1e6")))
+	assert.Equal(t, cnfgfile.MB, size)
+	require.NoError(t, size.UnmarshalJSON([]byte("null")), "null must be ignored")
+	assert.Equal(t, cnfgfile.MB, size, "null must not change the size")
+
+	for _, input := range []string{"-1e3", "1e20", "1e400", `"1e6"`, "NaN"} {
+		require.ErrorIs(t, size.UnmarshalJSON([]byte(input)), cnfgfile.ErrInvalidByteSize, input)
+	}
+
+	for _, input := range []float64{-1, math.NaN(), math.Inf(1), math.MaxUint64} {
+		require.ErrorIs(t, size.UnmarshalTOML(input), cnfgfile.ErrInvalidByteSize, input)
+	}
+
+	for _, input := range []string{"-1e3", "1e20", ".nan", `"1e6"`, "[1]"} {
+		require.ErrorIs(t, yaml.Unmarshal([]byte(input), &size), cnfgfile.ErrInvalidByteSize, input)
+	}
+
+	assert.Equal(t, cnfgfile.MB, size, "errors must not change the size")
+
+	size = 0
+	require.NoError(t, yaml.Unmarshal([]byte("2e3"), &size))
+	assert.Equal(t, cnfgfile.ByteSize(2000), size, "yaml exponents must be accepted like json and toml")
+	require.NoError(t, yaml.Unmarshal([]byte("1.5e3"), &size))
+	assert.Equal(t, cnfgfile.ByteSize(1500), size)
+}
+
+func TestByteSizeMaxSize(t *testing.T) {
+	t.Parallel()
+
+	file := makeTextFile(t)
+	data := &struct{ Name string }{Name: cnfgfile.DefaultPrefix + file}
+
+	var config struct{ MaxSize cnfgfile.ByteSize }
+	require.NoError(t, unmarshalFormat("toml", []byte(`MaxSize = "4B"`), &config))
+
+	_, err := cnfgfile.Parse(data, &cnfgfile.Opts{MaxSize: uint(config.MaxSize)})
+	require.NoError(t, err)
+	assert.Equal(t, "hi,", data.Name, "the value must be truncated to 4 bytes and trimmed")
+
+	data.Name = cnfgfile.DefaultPrefix + file
+	_, err = cnfgfile.Parse(data, &cnfgfile.Opts{MaxSize: math.MaxUint})
+	require.NoError(t, err)
+	assert.NotEmpty(t, data.Name, "the largest MaxSize must not overflow the read limit")
+}
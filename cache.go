@@ -0,0 +1,64 @@
+package cnfgfile
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// FileCache stores the content of files read by Parse(). Provide one in Opts to share it between
+// calls. The zero value is ready to use, and it's safe for concurrent use. Only successful reads
+// are cached, and files are cached by path (after Opts.TransformPath), encoding and Opts.MaxSize.
+type FileCache struct {
+	mu    sync.Mutex
+	items map[fileCacheKey]*fileContent
+}
+
+// fileCacheKey identifies a file read. The same file read with a different MaxSize is cached separately.
+type fileCacheKey struct {
+	path     string
+	encoding string
+	maxSize  uint
+}
+
+// Forget removes a file from the cache, so it's read again the next time it's referenced.
+// Use the path after Opts.TransformPath.
+func (c *FileCache) Forget(filePath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.items {
+		if key.path == filepath.Clean(filePath) {
+			delete(c.items, key)
+		}
+	}
+}
+
+// Clear removes every file from the cache.
+func (c *FileCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = nil
+}
+
+// get returns the cached content of a file.
+func (c *FileCache) get(filePath, encoding string, maxSize uint) (*fileContent, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	content, ok := c.items[fileCacheKey{path: filepath.Clean(filePath), encoding: encoding, maxSize: maxSize}]
+
+	return content, ok
+}
+
+// set saves the content of a file.
+func (c *FileCache) set(filePath, encoding string, maxSize uint, content *fileContent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.items == nil {
+		c.items = make(map[fileCacheKey]*fileContent)
+	}
+
+	c.items[fileCacheKey{path: filepath.Clean(filePath), encoding: encoding, maxSize: maxSize}] = content
+}
@@ -0,0 +1,84 @@
+package cnfgfile_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+func TestParseCache(t *testing.T) {
+	t.Parallel()
+
+	file := makeTextFile(t)
+	defer os.Remove(file)
+
+	data := &struct {
+		Plugins []struct{ APIKey string }
+	}{}
+	data.Plugins = make([]struct{ APIKey string }, 3)
+
+	for idx := range data.Plugins {
+		data.Plugins[idx].APIKey = cnfgfile.DefaultPrefix + file
+	}
+
+	// Change the file after it's read the first time.
+	opts := &cnfgfile.Opts{TransformFile: func(content string) string {
+		require.NoError(t, os.WriteFile(file, []byte("changed"), 0o600))
+		return content
+	}}
+
+	output, err := cnfgfile.Parse(data, opts)
+	require.NoError(t, err)
+	assert.Len(t, output, 3)
+
+	for _, plugin := range data.Plugins {
+		assert.Equal(t, "hi, this is a string", plugin.APIKey, "every element must get the same content")
+	}
+
+	data.Plugins[0].APIKey = cnfgfile.DefaultPrefix + file
+	_, err = cnfgfile.Parse(data, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "changed", data.Plugins[0].APIKey, "the cache must not be shared between calls by default")
+}
+
+func TestParseSharedCache(t *testing.T) {
+	t.Parallel()
+
+	file := makeTextFile(t)
+	defer os.Remove(file)
+
+	data := &struct{ Name string }{Name: cnfgfile.DefaultPrefix + file}
+	opts := &cnfgfile.Opts{Cache: &cnfgfile.FileCache{}}
+
+	_, err := cnfgfile.Parse(data, opts)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(file, []byte("changed"), 0o600))
+
+	data.Name = cnfgfile.DefaultPrefix + file
+	_, err = cnfgfile.Parse(data, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "hi, this is a string", data.Name, "a shared cache must return the original content")
+
+	data.Name = cnfgfile.DefaultPrefix + file
+	_, err = cnfgfile.Parse(data, &cnfgfile.Opts{Cache: opts.Cache, MaxSize: 3})
+	require.NoError(t, err)
+	assert.Equal(t, "cha", data.Name, "a different MaxSize must not use the cached content")
+
+	opts.Cache.Forget(file)
+
+	data.Name = cnfgfile.DefaultPrefix + file
+	_, err = cnfgfile.Parse(data, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "changed", data.Name, "a forgotten file must be read again")
+
+	require.NoError(t, os.WriteFile(file, []byte("changed again"), 0o600))
+	opts.Cache.Clear()
+
+	data.Name = cnfgfile.DefaultPrefix + file
+	_, err = cnfgfile.Parse(data, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "changed again", data.Name, "a cleared cache must read files again")
+}
@@ -0,0 +1,174 @@
+package cnfgfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"runtime/debug"
+	"strings"
+)
+
+// ErrIsDirectory is returned by Check when a reference points to a directory where a file is required.
+// Directories are only supported in maps and slices of strings.
+var ErrIsDirectory = errors.New("reference is a directory")
+
+// CheckResult is the report Check returns for each element with a reference.
+type CheckResult struct {
+	// Element is the derived name of the element, ie. Config.APIKey.
+	Element string
+	// Reference is the value of the element, without the prefix.
+	Reference string
+	// Path is the file (or directory) that Parse would read, after TransformPath and without a selector.
+	// This is the first alternative that exists, or the last one that was checked.
+	Path string
+	// Selector is the selector that follows the path, if any. Check does not read files to verify selectors.
+	Selector string
+	// Encoding is the encoding from the prefix, ie. base64, if any.
+	Encoding string
+	// Fallback is true if no file exists, and a literal fallback value (or an empty optional value) is used.
+	Fallback bool
+	// Exists is true if the path exists.
+	Exists bool
+	// Readable is true if the path can be opened by this process.
+	Readable bool
+	// Directory is true if the path is a directory. See ErrIsDirectory.
+	Directory bool
+	// Size is the size of the file on disk, so it's the compressed (or encoded) size, if applicable.
+	Size int64
+	// TooLarge is true if the file is larger than MaxSize. Parse truncates the content to MaxSize.
+	// The limit is SelectMaxSize if the reference has a selector. Err is ErrSelectSize for those, like Parse.
+	TooLarge bool
+	// Mode contains the permission bits of the path.
+	Mode fs.FileMode
+	// WorldReadable is true if every user on the system may read the file. This is often bad for secrets.
+	WorldReadable bool
+	// Err is the error Parse would return for this element, or nil if the reference can be resolved.
+	Err error
+}
+
+// Check is a dry run of Parse. It walks a data structure exactly like Parse does and finds every reference,
+// but it does not read the files, and does not change the data structure. Instead, each path (after
+// TransformPath) is checked; this includes alternatives and directories. Returns a result for each element
+// with a reference, in the order they were found. The returned error joins every element error (ElemError).
+// Use this to verify a config before you deploy it. Encrypted values are not checked.
+func Check(ptr interface{}, opts *Opts) (_ []*CheckResult, err error) {
+	if reflect.TypeOf(ptr).Kind() != reflect.Ptr {
+		return nil, ErrNotPtr
+	}
+
+	parser := opts.newParser()
+	parser.DryRun = true
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = &ElemError{
+				Name:  parser.CurrentElement,
+				File:  "",
+				Inner: fmt.Errorf("%w: %v\n%s", ErrPanic, r, string(debug.Stack())),
+			}
+		}
+	}()
+
+	if err := parser.Parse(reflect.ValueOf(ptr), parser.Name); err != nil {
+		return parser.Checks, err
+	}
+
+	errs := []error{}
+
+	for _, result := range parser.Checks {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+
+	return parser.Checks, errors.Join(errs...)
+}
+
+// checkSlice is the dry run version of parseSlice. Directories are allowed where Parse would expand them.
+func (p *parser) checkSlice(slice reflect.Value, name string) error {
+	dirAllowed := slice.Kind() == reflect.Slice && slice.Type().Elem().Kind() == reflect.String && slice.CanSet()
+
+	for idx := 0; idx < slice.Len(); idx++ {
+		p.CurrentElement = fmt.Sprintf("%s[%d/%d]", name, idx+1, slice.Len())
+
+		if _, _, ok := p.dirReference(slice.Index(idx)); ok && dirAllowed {
+			p.check(slice.Index(idx).String(), p.CurrentElement, true)
+		} else if err := p.Parse(slice.Index(idx), p.CurrentElement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// check adds a check result for a string element value, if it has our prefix.
+func (p *parser) check(value, name string, dirAllowed bool) {
+	value, encoding, ok := p.cutPrefix(value)
+	if !ok {
+		return
+	}
+
+	reference := strings.TrimSpace(value)
+	result := &CheckResult{Element: name, Reference: reference}
+
+	source, _, err := p.eachAlternative(reference, encoding, func(path, encoding string) error {
+		filePath, selector := p.splitSelector(path)
+		// Start over for each alternative.
+		*result = CheckResult{Element: name, Reference: reference, Selector: selector, Encoding: encoding}
+		result.Path = p.TransformPath(filePath)
+
+		return p.checkFile(result, dirAllowed && selector == "")
+	})
+	if err != nil {
+		result.Err = &ElemError{Name: name, File: result.Path, Inner: err}
+	} else if source == "" {
+		result.Fallback = true // Literal fallback value, or a missing optional file.
+	}
+
+	p.Checks = append(p.Checks, result)
+}
+
+// checkFile stats a file, and makes sure it can be opened. The file is not read.
+func (p *parser) checkFile(result *CheckResult, dirAllowed bool) error {
+	if _, err := decoder(nil, result.Encoding); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(result.Path)
+	if err != nil {
+		return fmt.Errorf("checking file: %w", err)
+	}
+
+	result.Exists = true
+	result.Directory = info.IsDir()
+	result.Size = info.Size()
+	result.Mode = info.Mode().Perm()
+	result.WorldReadable = result.Mode&0o004 != 0
+
+	maxSize := p.MaxSize
+	if result.Selector != "" {
+		maxSize = p.SelectMaxSize
+	}
+
+	result.TooLarge = !result.Directory && result.Size >= readLimit(maxSize)
+
+	file, err := os.Open(result.Path)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+
+	file.Close()
+	result.Readable = true
+
+	if result.Directory && !dirAllowed {
+		return fmt.Errorf("%w: %s", ErrIsDirectory, result.Path)
+	}
+
+	if result.TooLarge && result.Selector != "" {
+		return fmt.Errorf("%w: %d bytes", ErrSelectSize, p.SelectMaxSize)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package cnfgfile_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	file := writeFile(t, "secret", []byte("a secret value"))
+	require.NoError(t, os.Chmod(file, 0o644))
+
+	dir := filepath.Join(t.TempDir(), "dir")
+	require.NoError(t, os.Mkdir(dir, 0o700))
+
+	type config struct {
+		File        string
+		Missing     string
+		Optional    string
+		Fallback    string
+		Alternative string
+		Dir         string
+		Encoding    string
+		Plain       string
+		DirMap      map[string]string
+		DirSlice    []string
+	}
+
+	data := &config{
+		File:        "filepath:" + file,
+		Missing:     "filepath:/no_file",
+		Optional:    "filepath:/no_file?",
+		Fallback:    "filepath:/no_file|default",
+		Alternative: "filepath:/no_file|filepath:" + file + "#/key",
+		Dir:         "filepath:" + dir,
+		Encoding:    "filepath+rot13:" + file,
+		Plain:       "not a reference",
+		DirMap:      map[string]string{"dir": "filepath:" + dir},
+		DirSlice:    []string{"filepath:" + dir, "filepath:" + file},
+	}
+	original := *data
+
+	results, err := cnfgfile.Check(data, &cnfgfile.Opts{MaxSize: 4})
+	require.Error(t, err)
+	assert.Equal(t, original, *data, "the data structure must not change")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.ErrorIs(t, err, cnfgfile.ErrIsDirectory)
+	require.ErrorIs(t, err, cnfgfile.ErrUnknownEncoding)
+
+	byName := map[string]*cnfgfile.CheckResult{}
+	for _, result := range results {
+		byName[result.Element] = result
+	}
+
+	require.Len(t, byName, 10)
+
+	if runtime.GOOS != "windows" { // Windows does not have unix permissions.
+		assert.Equal(t, os.FileMode(0o644), byName["Config.File"].Mode)
+		assert.True(t, byName["Config.File"].WorldReadable)
+	}
+
+	byName["Config.File"].Mode, byName["Config.File"].WorldReadable = 0, false
+	assert.Equal(t, &cnfgfile.CheckResult{
+		Element: "Config.File", Reference: file, Path: file, Exists: true, Readable: true, Size: 14, TooLarge: true,
+	}, byName["Config.File"])
+
+	require.ErrorIs(t, byName["Config.Missing"].Err, os.ErrNotExist)
+	assert.False(t, byName["Config.Missing"].Exists)
+	assert.Equal(t, "/no_file", byName["Config.Missing"].Path)
+
+	require.NoError(t, byName["Config.Optional"].Err)
+	assert.True(t, byName["Config.Optional"].Fallback)
+	require.NoError(t, byName["Config.Fallback"].Err)
+	assert.True(t, byName["Config.Fallback"].Fallback)
+
+	require.NoError(t, byName["Config.Alternative"].Err)
+	assert.Equal(t, file, byName["Config.Alternative"].Path)
+	assert.Equal(t, "/key", byName["Config.Alternative"].Selector)
+
+	require.ErrorIs(t, byName["Config.Dir"].Err, cnfgfile.ErrIsDirectory, "directories only work in maps and slices")
+	require.ErrorIs(t, byName["Config.Encoding"].Err, cnfgfile.ErrUnknownEncoding)
+
+	require.NoError(t, byName["Config.DirMap[dir]"].Err)
+	assert.True(t, byName["Config.DirMap[dir]"].Directory)
+	require.NoError(t, byName["Config.DirSlice[1/2]"].Err)
+	assert.True(t, byName["Config.DirSlice[1/2]"].Directory)
+	require.NoError(t, byName["Config.DirSlice[2/2]"].Err)
+
+	data = &config{Alternative: "filepath:" + file + "#/key"}
+	_, parseErr := cnfgfile.Parse(data, &cnfgfile.Opts{SelectMaxSize: 4})
+	require.ErrorIs(t, parseErr, cnfgfile.ErrSelectSize)
+
+	results, err = cnfgfile.Check(data, &cnfgfile.Opts{SelectMaxSize: 4})
+	require.ErrorIs(t, err, cnfgfile.ErrSelectSize)
+	require.Len(t, results, 1)
+	assert.True(t, results[0].TooLarge)
+	require.ErrorIs(t, results[0].Err, cnfgfile.ErrSelectSize, "Check must return the error Parse returns")
+}
+
+func TestCheckTransformPath(t *testing.T) {
+	t.Parallel()
+
+	file := writeFile(t, "secret", []byte("value"))
+	data := &struct{ Name string }{Name: "filepath:~/secret"}
+
+	results, err := cnfgfile.Check(data, &cnfgfile.Opts{
+		TransformPath: func(path string) string { return filepath.Join(filepath.Dir(file), path[1:]) },
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, file, results[0].Path)
+	assert.Equal(t, "~/secret", results[0].Reference)
+	assert.False(t, results[0].TooLarge)
+
+	_, err = cnfgfile.Check(*data, nil)
+	require.ErrorIs(t, err, cnfgfile.ErrNotPtr)
+}
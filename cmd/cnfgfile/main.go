@@ -0,0 +1,447 @@
+// Package main is the cnfgfile command. It converts, validates, merges and inspects config files
+// with the same code that applications use to load them, so the results match what an application sees.
+//
+//	cnfgfile convert [-to format] [-o file] [-gzip] file
+//	cnfgfile validate file...
+//	cnfgfile merge [-to format] [-o file] [-gzip] file...
+//	cnfgfile refs [-prefix filepath:] [-max-size 1KiB] file...
+//
+// Every command accepts -key and -identity to decrypt encrypted config files.
+// Locations may be files, directories, glob patterns or URLs, see cnfgfile.UnmarshalWith.
+package main
+
+import (
+	"compress/gzip"
+	"crypto/ecdh"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"golift.io/cnfgfile"
+)
+
+const usage = `Usage: cnfgfile <command> [flags] <file>...
+
+Commands:
+  convert   Convert a config file into another format.
+  validate  Strictly parse config files and report errors with their line and column.
+  merge     Print the effective config after stacking several config files.
+  refs      List the file references in config files, and whether they resolve.
+
+Run cnfgfile <command> -h for the flags of each command.
+`
+
+var (
+	errUsage    = errors.New("invalid usage")
+	errNoFormat = errors.New("output format is unknown, provide -to or -o")
+	errInvalid  = errors.New("invalid config files")
+	errBadRefs  = errors.New("unresolved references")
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes a command and returns the exit code: 0 on success, 1 on failure, and 2 for usage errors.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2 //nolint:mnd
+	}
+
+	commands := map[string]func([]string, io.Writer, io.Writer) error{
+		"convert":  convert,
+		"validate": validate,
+		"merge":    merge,
+		"refs":     refs,
+	}
+
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command: %s\n\n%s", args[0], usage)
+		return 2 //nolint:mnd
+	}
+
+	switch err := command(args[1:], stdout, stderr); {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2 //nolint:mnd
+	case errors.Is(err, errInvalid), errors.Is(err, errBadRefs):
+		return 1 // The details are already printed.
+	default:
+		fmt.Fprintf(stderr, "cnfgfile %s: %v\n", args[0], err)
+		return 1
+	}
+}
+
+// flags contains the flags shared by every command.
+type flags struct {
+	*flag.FlagSet
+	key      string
+	identity string
+	// Output flags, only used by convert and merge.
+	format string
+	output string
+	gzip   bool
+}
+
+// newFlags returns a flag set with the decryption flags. Add the output flags with outputFlags.
+func newFlags(name, args string, stderr io.Writer) *flags {
+	set := &flags{FlagSet: flag.NewFlagSet(name, flag.ContinueOnError)}
+	set.SetOutput(stderr)
+	set.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: cnfgfile %s [flags] %s\n\nFlags:\n", name, args)
+		set.PrintDefaults()
+	}
+	set.StringVar(&set.key, "key", "", "file with a symmetric key (raw, hex or base64) to decrypt config files")
+	set.StringVar(&set.identity, "identity", "", "file with an X25519 private key (raw, hex or base64) to decrypt config files")
+
+	return set
+}
+
+// outputFlags adds the flags that control the output of convert and merge.
+func (f *flags) outputFlags() {
+	f.StringVar(&f.format, "to", "", "output format: json, yaml, toml or xml")
+	f.StringVar(&f.output, "o", "", "write the output to this file instead of stdout")
+	f.BoolVar(&f.gzip, "gzip", false, "gzip compress the output, this is automatic if -o ends with .gz")
+}
+
+// parse parses the command line, and returns an error if there are fewer than minArgs arguments.
+func (f *flags) parse(args []string, minArgs int) error {
+	if err := f.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err //nolint:wrapcheck
+		}
+
+		return fmt.Errorf("%w: %w", errUsage, err)
+	}
+
+	if f.NArg() < minArgs {
+		f.Usage()
+		return errUsage
+	}
+
+	return nil
+}
+
+// unmarshalOpts returns options with the keys from the -key and -identity flags.
+func (f *flags) unmarshalOpts() (*cnfgfile.UnmarshalOpts, error) {
+	opts := &cnfgfile.UnmarshalOpts{}
+
+	if f.key != "" {
+		key, err := readKey(f.key)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.DecryptKeys = [][]byte{key}
+	}
+
+	if f.identity != "" {
+		key, err := readKey(f.identity)
+		if err != nil {
+			return nil, err
+		}
+
+		identity, err := ecdh.X25519().NewPrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("identity %s: %w", f.identity, err)
+		}
+
+		opts.DecryptIdentities = []*ecdh.PrivateKey{identity}
+	}
+
+	return opts, nil
+}
+
+// readKey reads a key file, see cnfgfile.ParseKey.
+func readKey(fileName string) ([]byte, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("reading key: %w", err)
+	}
+
+	key, err := cnfgfile.ParseKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", fileName, err)
+	}
+
+	return key, nil
+}
+
+// load stacks every config file into one tree.
+func (f *flags) load(files []string) (map[string]interface{}, error) {
+	opts, err := f.unmarshalOpts()
+	if err != nil {
+		return nil, err
+	}
+
+	tree := map[string]interface{}{}
+	if _, err := cnfgfile.UnmarshalTree(tree, opts, files...); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return tree, nil
+}
+
+// write encodes a tree in the output format, and writes it to the output file or stdout.
+// The output format is chosen from the -to flag, then the -o file name, then the input file name.
+func (f *flags) write(tree map[string]interface{}, inputFile string, stdout io.Writer) error {
+	format := f.format
+
+	switch {
+	case format != "":
+	case f.output != "":
+		format = cnfgfile.FormatOf(f.output)
+	case inputFile != "":
+		format = cnfgfile.FormatOf(inputFile)
+	default:
+		return errNoFormat
+	}
+
+	data, err := cnfgfile.EncodeTree(tree, strings.ToLower(format))
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if f.output == "" {
+		return f.writeData(stdout, data)
+	}
+
+	file, err := os.Create(f.output)
+	if err != nil {
+		return fmt.Errorf("creating output: %w", err)
+	}
+
+	if err := f.writeData(file, data); err != nil {
+		return errors.Join(err, file.Close())
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("closing output: %w", err)
+	}
+
+	return nil
+}
+
+// writeData writes encoded data, and compresses it if -gzip is set or the output file name ends with .gz.
+// The compressor is closed here, because closing it writes the end of the gzip stream.
+func (f *flags) writeData(writer io.Writer, data []byte) error {
+	if !f.gzip && !strings.EqualFold(filepath.Ext(f.output), ".gz") {
+		if _, err := writer.Write(data); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+
+		return nil
+	}
+
+	compressor := gzip.NewWriter(writer)
+	if _, err := compressor.Write(data); err != nil {
+		return errors.Join(fmt.Errorf("writing output: %w", err), compressor.Close())
+	}
+
+	if err := compressor.Close(); err != nil {
+		return fmt.Errorf("compressing output: %w", err)
+	}
+
+	return nil
+}
+
+// convert converts one config file into another format.
+func convert(args []string, stdout, stderr io.Writer) error {
+	set := newFlags("convert", "<file>", stderr)
+	set.outputFlags()
+
+	if err := set.parse(args, 1); err != nil {
+		return err
+	}
+
+	if set.NArg() != 1 {
+		set.Usage()
+		return errUsage
+	}
+
+	tree, err := set.load(set.Args())
+	if err != nil {
+		return err
+	}
+
+	return set.write(tree, "", stdout)
+}
+
+// merge stacks several config files, and prints the result. Maps are merged, other values are replaced.
+func merge(args []string, stdout, stderr io.Writer) error {
+	set := newFlags("merge", "<file>...", stderr)
+	set.outputFlags()
+
+	if err := set.parse(args, 1); err != nil {
+		return err
+	}
+
+	tree, err := set.load(set.Args())
+	if err != nil {
+		return err
+	}
+
+	return set.write(tree, set.Arg(0), stdout)
+}
+
+// validate parses every config file on its own, and prints the result for each one.
+func validate(args []string, stdout, stderr io.Writer) error {
+	set := newFlags("validate", "<file>...", stderr)
+	if err := set.parse(args, 1); err != nil {
+		return err
+	}
+
+	opts, err := set.unmarshalOpts()
+	if err != nil {
+		return err
+	}
+
+	failed := false
+
+	for _, location := range set.Args() {
+		loaded, err := cnfgfile.UnmarshalTree(map[string]interface{}{}, opts, location)
+		if err != nil {
+			failed = true
+
+			fmt.Fprintln(stdout, "FAIL", err)
+
+			continue
+		}
+
+		for _, fileName := range loaded {
+			fmt.Fprintln(stdout, "ok", fileName)
+		}
+	}
+
+	if failed {
+		return errInvalid
+	}
+
+	return nil
+}
+
+// refs finds every file reference in the string values of config files, and checks if they resolve.
+// The files are never read, so secrets are not printed. See cnfgfile.Check.
+func refs(args []string, stdout, stderr io.Writer) error {
+	set := newFlags("refs", "<file>...", stderr)
+	opts := &cnfgfile.Opts{Name: "refs", Prefix: cnfgfile.DefaultPrefix, MaxSize: cnfgfile.DefaultMaxSize}
+	maxSize := cnfgfile.ByteSize(opts.MaxSize)
+	set.StringVar(&opts.Prefix, "prefix", opts.Prefix, "prefix that marks a file reference")
+	set.TextVar(&maxSize, "max-size", maxSize, "references larger than this are truncated")
+
+	if err := set.parse(args, 1); err != nil {
+		return err
+	}
+
+	opts.MaxSize = uint(maxSize)
+
+	tree, err := set.load(set.Args())
+	if err != nil {
+		return err
+	}
+
+	values := map[string]string{}
+	flatten(values, "", tree)
+
+	results, checkErr := cnfgfile.Check(&values, opts)
+	sort.Slice(results, func(i, j int) bool { return results[i].Element < results[j].Element })
+
+	table := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0) //nolint:mnd
+	fmt.Fprintln(table, "KEY\tSTATUS\tPATH\tSIZE\tNOTES")
+
+	for _, result := range results {
+		key := strings.TrimSuffix(strings.TrimPrefix(result.Element, opts.Name+"["), "]")
+		fmt.Fprintf(table, "%s\t%s\t%s\t%d\t%s\n", key, status(result), result.Path, result.Size, notes(result))
+	}
+
+	if err := table.Flush(); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+
+	if checkErr != nil {
+		return errBadRefs
+	}
+
+	return nil
+}
+
+// flatten copies every string in a tree into a map. The keys are paths, ie. db.password and hosts[0].
+func flatten(values map[string]string, path string, node interface{}) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		if path != "" {
+			path += "."
+		}
+
+		for key, value := range node {
+			flatten(values, path+key, value)
+		}
+	case []interface{}:
+		for idx, value := range node {
+			flatten(values, fmt.Sprintf("%s[%d]", path, idx), value)
+		}
+	case string:
+		values[path] = node
+	}
+}
+
+// status summarizes a check result in one word.
+func status(result *cnfgfile.CheckResult) string {
+	switch {
+	case result.Err != nil && errors.Is(result.Err, os.ErrNotExist):
+		return "missing"
+	case result.Err != nil:
+		return "error"
+	case result.Fallback:
+		return "fallback"
+	default:
+		return "ok"
+	}
+}
+
+// notes lists anything noteworthy about a check result.
+func notes(result *cnfgfile.CheckResult) string {
+	var notes []string
+
+	if result.Err != nil {
+		var elemErr *cnfgfile.ElemError
+		if errors.As(result.Err, &elemErr) {
+			notes = append(notes, elemErr.Inner.Error())
+		} else {
+			notes = append(notes, result.Err.Error())
+		}
+	}
+
+	if result.Directory {
+		notes = append(notes, "directory")
+	}
+
+	if result.Selector != "" {
+		notes = append(notes, "selector "+result.Selector)
+	}
+
+	if result.Encoding != "" {
+		notes = append(notes, "encoding "+result.Encoding)
+	}
+
+	if result.TooLarge {
+		notes = append(notes, "truncated")
+	}
+
+	if result.WorldReadable {
+		notes = append(notes, "world-readable")
+	}
+
+	return strings.Join(notes, ", ")
+}
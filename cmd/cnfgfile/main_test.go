@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+func execute(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+
+	code := run(args, &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	fileName := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(fileName, []byte(content), 0o600))
+
+	return fileName
+}
+
+func TestRunUsage(t *testing.T) {
+	t.Parallel()
+
+	code, _, stderr := execute()
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "Usage: cnfgfile")
+
+	code, _, stderr = execute("nope")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "unknown command: nope")
+
+	code, _, stderr = execute("convert")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "Usage: cnfgfile convert")
+
+	code, _, _ = execute("merge", "-h")
+	assert.Equal(t, 0, code)
+
+	code, _, stderr = execute("convert", "../../tests/config.json")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "output format is unknown")
+}
+
+func TestConvert(t *testing.T) {
+	t.Parallel()
+
+	code, stdout, stderr := execute("convert", "-to", "yaml", "../../tests/config.json.gz")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "pstruct:\n  string: foo2\n")
+
+	// Convert to a gzipped file, and back again.
+	output := filepath.Join(t.TempDir(), "config.toml.gz")
+	code, stdout, stderr = execute("convert", "-o", output, "../../tests/config.yaml.bz2")
+	require.Equal(t, 0, code, stderr)
+	assert.Empty(t, stdout)
+
+	file, err := os.Open(output)
+	require.NoError(t, err)
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	require.NoError(t, err, "the output must be compressed")
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "[pstruct]")
+
+	code, stdout, stderr = execute("convert", "-to", "json", output)
+	require.Equal(t, 0, code, stderr)
+
+	expected, err := os.ReadFile("../../tests/config.json")
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expected), stdout)
+}
+
+func TestConvertWriteError(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("/dev/full only exists on linux")
+	}
+
+	// Writes to /dev/full fail. Compressed output is buffered, so this fails when the compressor is closed.
+	for _, args := range [][]string{{"-to", "json"}, {"-to", "json", "-gzip"}} {
+		code, _, stderr := execute(append(append([]string{"convert"}, args...), "-o", "/dev/full",
+			"../../tests/config.json")...)
+		assert.Equal(t, 1, code, args)
+		assert.Contains(t, stderr, "no space left on device", args)
+	}
+}
+
+func TestConvertEncrypted(t *testing.T) {
+	t.Parallel()
+
+	key, err := cnfgfile.GenerateKey()
+	require.NoError(t, err)
+
+	encrypted, err := cnfgfile.EncryptConfig([]byte("password: secret\n"), "config.yaml",
+		&cnfgfile.EncryptOpts{Keys: [][]byte{key}})
+	require.NoError(t, err)
+
+	configFile := writeFile(t, "config.yaml", string(encrypted))
+	keyFile := writeFile(t, "key", string(key))
+
+	code, _, stderr := execute("convert", "-to", "json", configFile)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, cnfgfile.ErrNoFileKey.Error())
+
+	code, stdout, stderr := execute("convert", "-to", "json", "-key", keyFile, configFile)
+	require.Equal(t, 0, code, stderr)
+	assert.JSONEq(t, `{"password": "secret"}`, stdout)
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	broken := writeFile(t, "broken.json", "{\n  \"a\": 1,\n  \"a\": 2\n}")
+
+	code, stdout, _ := execute("validate", "../../tests/config.toml", "../../tests/config.xml")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "ok ../../tests/config.toml\nok ../../tests/config.xml\n", stdout)
+
+	code, stdout, _ = execute("validate", "../../tests/config.yaml", broken)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, "ok ../../tests/config.yaml\n")
+	assert.Contains(t, stdout, "FAIL "+broken+":3:")
+	assert.Contains(t, stdout, cnfgfile.ErrDuplicateKey.Error())
+}
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+
+	override := writeFile(t, "override.json", `{"struct": {"bool": true, "int": 5}}`)
+
+	code, stdout, stderr := execute("merge", "-to", "json", "../../tests/config.yaml", override)
+	require.Equal(t, 0, code, stderr)
+	assert.JSONEq(t, `{
+		"pslice": [{"bool": true, "float": 123.4567}],
+		"sslice": [{"string": "foo", "int": 123}],
+		"struct": {"bool": true, "int": 5},
+		"pstruct": {"string": "foo2"}
+	}`, stdout)
+
+	// The format of the first file is the default.
+	code, stdout, stderr = execute("merge", "../../tests/config.toml", override)
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "[struct]\n  bool = true\n  int = 5\n")
+}
+
+func TestRefs(t *testing.T) {
+	t.Parallel()
+
+	secret := writeFile(t, "secret", "password")
+	config := writeFile(t, "config.yaml", "db:\n  password: filepath:"+secret+"\n  user: admin\n"+
+		"hosts:\n  - filepath:/no_file\n  - filepath:/no_file|fallback\n")
+
+	code, stdout, _ := execute("refs", config)
+	assert.Equal(t, 1, code, "a missing reference must fail")
+	assert.Regexp(t, `db.password\s+ok\s+`+regexp.QuoteMeta(secret)+`\s+8`, stdout)
+	assert.Regexp(t, `hosts\[0\]\s+missing\s+/no_file`, stdout)
+	assert.Regexp(t, `hosts\[1\]\s+fallback\s+/no_file`, stdout)
+	assert.NotContains(t, stdout, "admin", "only references are listed")
+
+	code, stdout, _ = execute("refs", "-prefix", "file:", "-max-size", "4B", config)
+	assert.Equal(t, 0, code, "no references use this prefix")
+	assert.Equal(t, "KEY  STATUS  PATH  SIZE  NOTES\n", stdout)
+
+	config = writeFile(t, "config.json", `{"key": "filepath:`+filepath.ToSlash(secret)+`"}`)
+	code, stdout, _ = execute("refs", "-max-size", "4B", config)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "truncated")
+
+	if runtime.GOOS != "windows" {
+		require.NoError(t, os.Chmod(secret, 0o644))
+
+		_, stdout, _ = execute("refs", config)
+		assert.Contains(t, stdout, "world-readable")
+	}
+}
@@ -0,0 +1,250 @@
+package cnfgfile
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTag is the struct tag SetDefaults() reads default values from.
+// Slices are provided as comma separated lists, ie. `default:"one,two"`.
+const DefaultTag = "default"
+
+// ErrUnsupportedType is returned when a string cannot be converted into an element's type.
+var ErrUnsupportedType = errors.New("unsupported type")
+
+// SetDefaults applies the values in `default` struct tags to a data structure.
+// Call this before Unmarshal() so the values in your config files override the defaults.
+// It is fully recursive, like Parse, and supports strings, numbers, bools, Durations,
+// slices, and anything with an UnmarshalText method. Nil pointers are allocated when the
+// element they point to has a default, but recursive pointers are only allocated once.
+// Only elements with a zero value are changed.
+// The output map is a map of Config.Item => default value for every tagged element,
+// including those that were not changed. Use it to document your defaults.
+// Only Opts.Name and Opts.MaxDepth are used; opts may be nil.
+func SetDefaults(ptr interface{}, opts *Opts) (map[string]string, error) {
+	if ptr == nil || reflect.TypeOf(ptr).Kind() != reflect.Ptr {
+		return nil, ErrNotPtr
+	}
+
+	defaulter := &defaulter{parser: opts.newParser(), Allocating: make(map[reflect.Type]bool)}
+
+	return defaulter.Output, defaulter.setDefaults(reflect.ValueOf(ptr), defaulter.Name)
+}
+
+// defaulter walks a data structure and sets default values.
+type defaulter struct {
+	*parser
+	// Allocating contains the types of nil pointers allocated by the current element and its parents.
+	// Used to avoid allocating recursive pointers until MaxDepth is reached.
+	Allocating map[reflect.Type]bool
+}
+
+// setDefaults recurses into an element and applies the default tags it finds on struct members.
+func (p *defaulter) setDefaults(elem reflect.Value, name string) error {
+	p.CurrentDepth++
+	defer func() { p.CurrentDepth-- }()
+
+	if p.CurrentDepth > p.MaxDepth {
+		return nil
+	}
+
+	switch elem.Kind() { //nolint:exhaustive // Other kinds have no members to set.
+	case reflect.Pointer:
+		return p.setPointerDefaults(elem, name)
+	case reflect.Struct:
+		return p.setStructDefaults(elem, name)
+	case reflect.Slice, reflect.Array:
+		for idx := 0; idx < elem.Len(); idx++ {
+			if err := p.setDefaults(elem.Index(idx), fmt.Sprintf("%s[%d/%d]", name, idx+1, elem.Len())); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range elem.MapKeys() {
+			elemCopy := reflect.New(elem.MapIndex(key).Type()).Elem()
+			elemCopy.Set(elem.MapIndex(key))
+
+			if err := p.setDefaults(elemCopy, fmt.Sprint(name, "[", key, "]")); err != nil {
+				return err
+			}
+
+			elem.SetMapIndex(key, elemCopy)
+		}
+	}
+
+	return nil
+}
+
+// setPointerDefaults allocates nil pointers to types with defaults, and recurses into the pointer's element.
+func (p *defaulter) setPointerDefaults(elem reflect.Value, name string) error {
+	if !elem.IsNil() {
+		return p.setDefaults(elem.Elem(), name)
+	}
+
+	typ := elem.Type().Elem()
+	if !elem.CanSet() || p.Allocating[typ] || !hasDefaults(typ, map[reflect.Type]bool{}) {
+		return nil
+	}
+
+	p.Allocating[typ] = true
+	defer delete(p.Allocating, typ)
+
+	elem.Set(reflect.New(typ))
+
+	return p.setDefaults(elem.Elem(), name)
+}
+
+// setStructDefaults sets the default on each tagged member, and recurses into every member.
+func (p *defaulter) setStructDefaults(elem reflect.Value, name string) error {
+	for _, field := range reflect.VisibleFields(elem.Type()) {
+		if !field.IsExported() || len(field.Index) > 1 {
+			continue // Promoted fields are handled when their embedded struct is.
+		}
+
+		member := elem.FieldByIndex(field.Index)
+		p.CurrentElement = name + "." + field.Name
+
+		if value, ok := field.Tag.Lookup(DefaultTag); ok {
+			p.Output[p.CurrentElement] = value
+
+			if member.IsZero() && member.CanSet() {
+				if err := setValue(member, value); err != nil {
+					return &ElemError{Name: p.CurrentElement, File: "", Inner: err}
+				}
+			}
+		}
+
+		if err := p.setDefaults(member, p.CurrentElement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasDefaults returns true if a type contains a default tag anywhere inside it.
+// The seen map prevents infinite recursion with recursive types.
+func hasDefaults(typ reflect.Type, seen map[reflect.Type]bool) bool {
+	for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		typ = typ.Elem()
+	}
+
+	if typ.Kind() != reflect.Struct || seen[typ] {
+		return false
+	}
+
+	seen[typ] = true
+
+	for idx := 0; idx < typ.NumField(); idx++ {
+		field := typ.Field(idx)
+		if !field.IsExported() {
+			continue
+		}
+
+		if _, ok := field.Tag.Lookup(DefaultTag); ok {
+			return true
+		}
+
+		// Slices are not allocated, so only look inside structs and pointers.
+		if field.Type.Kind() != reflect.Slice && hasDefaults(field.Type, seen) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setValue converts a string into the element's type and sets the element to the converted value.
+// Supports anything with an UnmarshalText method, strings, numbers, bools, time.Duration,
+// pointers to those types, and comma separated slices of those types.
+func setValue(elem reflect.Value, value string) error {
+	if elem.CanAddr() {
+		if unmarshaler, ok := elem.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return unmarshaler.UnmarshalText([]byte(value)) //nolint:wrapcheck // Do not wrap our own types.
+		}
+	}
+
+	var err error
+
+	switch elem.Kind() { //nolint:exhaustive // Other kinds are not supported.
+	case reflect.String:
+		elem.SetString(value)
+	case reflect.Pointer:
+		ptr := reflect.New(elem.Type().Elem())
+		if err = setValue(ptr.Elem(), value); err == nil {
+			elem.Set(ptr)
+		}
+	case reflect.Slice:
+		err = setSlice(elem, value)
+	case reflect.Bool:
+		var val bool
+		if val, err = strconv.ParseBool(value); err == nil {
+			elem.SetBool(val)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		err = setInt(elem, value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var val uint64
+		if val, err = strconv.ParseUint(value, 0, elem.Type().Bits()); err == nil {
+			elem.SetUint(val)
+		}
+	case reflect.Float32, reflect.Float64:
+		var val float64
+		if val, err = strconv.ParseFloat(value, elem.Type().Bits()); err == nil {
+			elem.SetFloat(val)
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedType, elem.Type())
+	}
+
+	if err != nil {
+		return fmt.Errorf("converting '%s' to %s: %w", value, elem.Type(), err)
+	}
+
+	return nil
+}
+
+// setInt sets an integer, and parses the value as a duration if the element is a time.Duration.
+func setInt(elem reflect.Value, value string) error {
+	if elem.Type() == reflect.TypeOf(time.Duration(0)) {
+		dur, err := ParseDuration(value)
+		if err == nil {
+			elem.SetInt(int64(dur))
+		}
+
+		return err //nolint:wrapcheck // It gets wrapped.
+	}
+
+	val, err := strconv.ParseInt(value, 0, elem.Type().Bits())
+	if err == nil {
+		elem.SetInt(val)
+	}
+
+	return err //nolint:wrapcheck // It gets wrapped.
+}
+
+// setSlice splits a comma separated list and sets each value into a new slice.
+func setSlice(elem reflect.Value, value string) error {
+	if value == "" {
+		elem.Set(reflect.MakeSlice(elem.Type(), 0, 0))
+		return nil
+	}
+
+	items := strings.Split(value, ",")
+	slice := reflect.MakeSlice(elem.Type(), len(items), len(items))
+
+	for idx, item := range items {
+		if err := setValue(slice.Index(idx), strings.TrimSpace(item)); err != nil {
+			return err
+		}
+	}
+
+	elem.Set(slice)
+
+	return nil
+}
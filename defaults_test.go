@@ -0,0 +1,97 @@
+package cnfgfile_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+type defaultStruct struct {
+	Name     string            `default:"me"`
+	Count    int               `default:"5"`
+	Mode     uint16            `default:"0o640"`
+	Ratio    float64           `default:"0.5"`
+	Enabled  bool              `default:"true"`
+	Interval cnfgfile.Duration `default:"1m"`
+	Timeout  time.Duration     `default:"2s"`
+	Tags     []string          `default:"one, two"`
+	Ports    []int             `default:"80,443"`
+	StrPtr   *string           `default:"pointer"`
+	Sub      *defaultSub
+	Subs     []defaultSub
+	Empty    *testSubConfig
+	Set      string `default:"not used"`
+}
+
+type defaultSub struct {
+	Address string `default:"localhost"`
+	Next    *defaultSub
+}
+
+func TestSetDefaults(t *testing.T) {
+	t.Parallel()
+
+	data := &defaultStruct{Set: "already set", Subs: []defaultSub{{}, {Address: "remote"}}}
+
+	output, err := cnfgfile.SetDefaults(data, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "me", data.Name)
+	assert.Equal(t, 5, data.Count)
+	assert.EqualValues(t, 0o640, data.Mode)
+	assert.InDelta(t, 0.5, data.Ratio, 0)
+	assert.True(t, data.Enabled)
+	assert.Equal(t, time.Minute, data.Interval.Duration)
+	assert.Equal(t, 2*time.Second, data.Timeout)
+	assert.Equal(t, []string{"one", "two"}, data.Tags)
+	assert.Equal(t, []int{80, 443}, data.Ports)
+	require.NotNil(t, data.StrPtr)
+	assert.Equal(t, "pointer", *data.StrPtr)
+	require.NotNil(t, data.Sub, "pointers to structs with defaults must be allocated")
+	assert.Equal(t, "localhost", data.Sub.Address)
+	assert.Nil(t, data.Sub.Next, "recursive pointers must only be allocated once")
+	assert.Equal(t, "localhost", data.Subs[0].Address)
+	assert.Equal(t, "remote", data.Subs[1].Address, "non-zero values must not be overwritten")
+	assert.Nil(t, data.Empty, "pointers to structs without defaults must not be allocated")
+	assert.Equal(t, "already set", data.Set, "non-zero values must not be overwritten")
+
+	assert.Equal(t, "1m", output["Config.Interval"])
+	assert.Equal(t, "not used", output["Config.Set"], "all defaults must be in the output map")
+	assert.Equal(t, "localhost", output["Config.Subs[2/2].Address"])
+}
+
+func TestSetDefaultsErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := cnfgfile.SetDefaults(defaultStruct{}, nil)
+	require.ErrorIs(t, err, cnfgfile.ErrNotPtr)
+
+	data := &struct {
+		Count int `default:"five"`
+	}{}
+	_, err = cnfgfile.SetDefaults(data, &cnfgfile.Opts{Name: "MyThing"})
+	require.ErrorContains(t, err, "element failure: MyThing.Count: converting 'five' to int")
+
+	data2 := &struct {
+		Map map[string]string `default:"a:b"`
+	}{}
+	_, err = cnfgfile.SetDefaults(data2, nil)
+	require.ErrorIs(t, err, cnfgfile.ErrUnsupportedType)
+}
+
+func TestSetDefaultsUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	config := &struct {
+		testStruct
+		Extra string `default:"extra" toml:"extra"`
+	}{}
+
+	_, err := cnfgfile.SetDefaults(config, nil)
+	require.NoError(t, err)
+	require.NoError(t, cnfgfile.Unmarshal(config, "tests/config.toml"))
+	assert.Equal(t, "extra", config.Extra, "the default must remain when the file does not set it")
+	assert.Equal(t, "foo2", *config.PointerStruct.StringP, "the file must still be unmarshaled")
+}
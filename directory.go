@@ -0,0 +1,130 @@
+package cnfgfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// dirReference returns the path (and encoding) in a string that has our prefix, if the path is a directory.
+func (p *parser) dirReference(elem reflect.Value) (string, string, bool) {
+	if elem.Kind() != reflect.String {
+		return "", "", false
+	}
+
+	dirPath, encoding, ok := p.cutPrefix(elem.String())
+	if !ok {
+		return "", "", false
+	}
+
+	dirPath = strings.TrimSpace(dirPath)
+	if info, err := os.Stat(p.TransformPath(dirPath)); err != nil || !info.IsDir() {
+		return "", "", false
+	}
+
+	return dirPath, encoding, true
+}
+
+// expandMap replaces a map entry that references a directory with an entry for each file in the directory.
+func (p *parser) expandMap(elem, key reflect.Value, dirPath, encoding, name string) error {
+	p.CurrentElement = fmt.Sprint(name, "[", key, "]")
+
+	fileNames, contents, err := p.readDir(dirPath, encoding)
+	if err != nil {
+		return &ElemError{Name: p.CurrentElement, File: dirPath, Inner: err}
+	}
+
+	elem.SetMapIndex(key, reflect.Value{}) // Delete the reference.
+
+	for idx, fileName := range fileNames {
+		p.Output[fmt.Sprint(name, "[", fileName, "]")] = filepath.Join(dirPath, fileName)
+		elem.SetMapIndex(reflect.ValueOf(fileName).Convert(elem.Type().Key()),
+			reflect.ValueOf(contents[idx]).Convert(elem.Type().Elem()))
+	}
+
+	return nil
+}
+
+// expandSlice replaces slice elements that reference a directory with an element for each file in the directory.
+// Returns the indexes of the new elements, so they are not parsed again.
+func (p *parser) expandSlice(slice reflect.Value, name string) (map[int]bool, error) {
+	if slice.Kind() != reflect.Slice || slice.Type().Elem().Kind() != reflect.String || !slice.CanSet() {
+		return nil, nil
+	}
+
+	var (
+		output   = reflect.MakeSlice(slice.Type(), 0, slice.Len())
+		expanded = make(map[int]bool)
+		paths    = make(map[int]string)
+	)
+
+	for idx := 0; idx < slice.Len(); idx++ {
+		dirPath, encoding, ok := p.dirReference(slice.Index(idx))
+		if !ok {
+			output = reflect.Append(output, slice.Index(idx))
+			continue
+		}
+
+		p.CurrentElement = fmt.Sprintf("%s[%d/%d]", name, idx+1, slice.Len())
+
+		fileNames, contents, err := p.readDir(dirPath, encoding)
+		if err != nil {
+			return nil, &ElemError{Name: p.CurrentElement, File: dirPath, Inner: err}
+		}
+
+		for idx, content := range contents {
+			expanded[output.Len()] = true
+			paths[output.Len()] = filepath.Join(dirPath, fileNames[idx])
+			output = reflect.Append(output, reflect.ValueOf(content).Convert(slice.Type().Elem()))
+		}
+	}
+
+	if len(expanded) == 0 {
+		return nil, nil
+	}
+
+	for idx, path := range paths {
+		p.Output[fmt.Sprintf("%s[%d/%d]", name, idx+1, output.Len())] = path
+	}
+
+	slice.Set(output)
+
+	return expanded, nil
+}
+
+// readDir reads every file in a directory. Hidden files and sub directories are skipped.
+// Symlinks are followed, so the Kubernetes ..data layout works. Returns the file names and their contents.
+func (p *parser) readDir(dirPath, encoding string) ([]string, []string, error) {
+	transformed := p.TransformPath(dirPath)
+
+	entries, err := os.ReadDir(transformed)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading directory: %w", err)
+	}
+
+	fileNames := []string{}
+	contents := []string{}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		filePath := filepath.Join(transformed, entry.Name())
+		if info, err := os.Stat(filePath); err != nil || info.IsDir() {
+			continue // Skip broken links and directories.
+		}
+
+		content, err := p.readFile(filePath, encoding)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+
+		fileNames = append(fileNames, entry.Name())
+		contents = append(contents, p.TransformFile(content))
+	}
+
+	return fileNames, contents, nil
+}
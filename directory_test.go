@@ -0,0 +1,81 @@
+package cnfgfile_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+// makeSecretDir creates a directory with the same layout as a Kubernetes secret volume.
+func makeSecretDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	data := filepath.Join(dir, "..2024_01_01_00_00_00.000000000")
+	require.NoError(t, os.Mkdir(data, 0o700))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(data, "username"), []byte("admin\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(data, "password"), []byte("hunter2\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden"), []byte("hidden"), 0o600))
+	require.NoError(t, os.Symlink(filepath.Base(data), filepath.Join(dir, "..data")))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "username"), filepath.Join(dir, "username")))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "password"), filepath.Join(dir, "password")))
+
+	return dir
+}
+
+func TestParseDirectory(t *testing.T) {
+	t.Parallel()
+
+	dir := makeSecretDir(t)
+	data := &struct {
+		Map     map[string]string
+		Secrets map[string]cnfgfile.Secret
+		Slice   []string
+		NoDir   map[string]string
+	}{
+		Map:     map[string]string{"dir": cnfgfile.DefaultPrefix + dir, "other": "value"},
+		Secrets: map[string]cnfgfile.Secret{"dir": cnfgfile.Secret(cnfgfile.DefaultPrefix + dir)},
+		Slice:   []string{"first", cnfgfile.DefaultPrefix + dir, "last"},
+		NoDir:   map[string]string{"dir": cnfgfile.DefaultPrefix + dir + "/username"},
+	}
+
+	output, err := cnfgfile.Parse(data, &cnfgfile.Opts{MaxSize: 5})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin", "password": "hunte", "other": "value"}, data.Map,
+		"the directory reference must be replaced with the file contents, truncated to MaxSize")
+	assert.Equal(t, "admin", data.Secrets["username"].Reveal())
+	assert.Equal(t, []string{"first", "hunte", "admin", "last"}, data.Slice, "files must be in lexical order")
+	assert.Equal(t, map[string]string{"dir": "admin"}, data.NoDir)
+
+	assert.Equal(t, filepath.Join(dir, "username"), output["Config.Map[username]"])
+	assert.Equal(t, filepath.Join(dir, "password"), output["Config.Slice[2/4]"])
+	assert.Equal(t, filepath.Join(dir, "username"), output["Config.Slice[3/4]"])
+	assert.NotContains(t, output, "Config.Map[.hidden]")
+	assert.NotContains(t, output, "Config.Map[subdir]")
+}
+
+func TestParseDirectoryError(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.Symlink("/no_file", filepath.Join(dir, "broken")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "unreadable"), []byte("data"), 0o000))
+
+	data := &struct{ Map map[string]string }{Map: map[string]string{"dir": cnfgfile.DefaultPrefix + dir}}
+
+	_, err := cnfgfile.Parse(data, nil)
+	if os.Getuid() == 0 {
+		require.NoError(t, err, "root can read any file")
+		assert.Equal(t, map[string]string{"unreadable": "data"}, data.Map, "broken links must be skipped")
+
+		return
+	}
+
+	require.ErrorContains(t, err, "element failure: Config.Map[dir]")
+	require.ErrorIs(t, err, os.ErrPermission)
+}
@@ -3,22 +3,87 @@ package cnfgfile
 import (
 	"encoding"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"math"
+	"math/bits"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
+
+	toml "github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v3"
 )
 
-/*** This code also exists in the golift.io/cnfg package. It is identical. ***/
+/*** This code started in the golift.io/cnfg package. This copy also parses days, weeks and ISO-8601. ***/
+
+// Duration units that time.ParseDuration does not understand.
+const (
+	Day  = 24 * time.Hour
+	Week = 7 * Day
+)
+
+// ErrInvalidDuration is returned when a duration cannot be parsed.
+var ErrInvalidDuration = errors.New("invalid duration")
 
 // Duration is useful if you need to load a time Duration from a config file into
 // your application. Use the config.Duration type to support automatic unmarshal
-// from all sources.
+// from all sources. In addition to the time.ParseDuration syntax, the d (day) and
+// w (week) units are accepted, ie. 7d or 1w2d12h, as are ISO-8601 durations, ie. P1DT12H.
+// Plain numbers (strings or numeric values) are seconds, ie. 30 is 30s. Use DurationIn for another unit.
 type Duration struct{ time.Duration }
 
+// DurationUnit is the unit of a plain number in a DurationIn, ie. Milliseconds.
+type DurationUnit interface {
+	Unit() time.Duration
+}
+
+// Units for DurationIn.
+type (
+	Milliseconds struct{}
+	Seconds      struct{}
+	Minutes      struct{}
+	Hours        struct{}
+)
+
+// Unit returns a millisecond.
+func (Milliseconds) Unit() time.Duration { return time.Millisecond }
+
+// Unit returns a second.
+func (Seconds) Unit() time.Duration { return time.Second }
+
+// Unit returns a minute.
+func (Minutes) Unit() time.Duration { return time.Minute }
+
+// Unit returns an hour.
+func (Hours) Unit() time.Duration { return time.Hour }
+
+// DurationIn is a Duration that treats plain numbers as another unit, ie. `timeout = 500` is
+// 500ms in a DurationIn[Milliseconds]. Strings with a unit, ie. 1m, are parsed the same as a Duration.
+// The unit is part of the type, so it works with every decoder and cannot change at runtime.
+type DurationIn[U DurationUnit] struct{ Duration }
+
 // UnmarshalText parses a duration type from a config file. This method works
 // with the Duration type to allow unmarshaling of durations from files and
 // env variables in the same struct. You won't generally call this directly.
 func (d *Duration) UnmarshalText(b []byte) error {
-	dur, err := time.ParseDuration(string(b))
+	return d.unmarshalText(b, time.Second)
+}
+
+// UnmarshalText parses a duration, and multiplies a plain number by the unit.
+func (d *DurationIn[U]) UnmarshalText(b []byte) error {
+	var unit U
+	return d.unmarshalText(b, unit.Unit())
+}
+
+func (d *Duration) unmarshalText(b []byte, unit time.Duration) error {
+	dur, ok, err := parseNumber(string(b), unit)
+	if !ok {
+		dur, err = ParseDuration(string(b))
+	}
+
 	if err != nil {
 		return fmt.Errorf("parsing duration '%s': %w", b, err)
 	}
@@ -28,19 +93,149 @@ func (d *Duration) UnmarshalText(b []byte) error {
 	return nil
 }
 
-// MarshalText returns the string representation of a Duration. ie. 1m32s.
+// UnmarshalJSON parses a duration from a JSON string, ie. "1m32s", or a JSON number, ie. 92.
+// A null does not change the duration.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	return d.unmarshalJSON(b, time.Second)
+}
+
+// UnmarshalJSON parses a duration from a JSON string or number. A number is multiplied by the unit.
+func (d *DurationIn[U]) UnmarshalJSON(b []byte) error {
+	var unit U
+	return d.unmarshalJSON(b, unit.Unit())
+}
+
+func (d *Duration) unmarshalJSON(b []byte, unit time.Duration) error {
+	if string(b) == "null" {
+		return nil
+	}
+
+	if str, err := strconv.Unquote(string(b)); err == nil {
+		return d.unmarshalText([]byte(str), unit)
+	}
+
+	return d.unmarshalText(b, unit)
+}
+
+// UnmarshalYAML parses a duration from a YAML string or number.
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.unmarshalYAML(node, time.Second)
+}
+
+// UnmarshalYAML parses a duration from a YAML string or number. A number is multiplied by the unit.
+func (d *DurationIn[U]) UnmarshalYAML(node *yaml.Node) error {
+	var unit U
+	return d.unmarshalYAML(node, unit.Unit())
+}
+
+func (d *Duration) unmarshalYAML(node *yaml.Node, unit time.Duration) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("%w: yaml line %d: must be a string or number", ErrInvalidDuration, node.Line)
+	}
+
+	return d.unmarshalText([]byte(node.Value), unit)
+}
+
+// UnmarshalTOML parses a duration from a TOML string, integer or float.
+func (d *Duration) UnmarshalTOML(data interface{}) error {
+	return d.unmarshalTOML(data, time.Second)
+}
+
+// UnmarshalTOML parses a duration from a TOML string, integer or float. A number is multiplied by the unit.
+func (d *DurationIn[U]) UnmarshalTOML(data interface{}) error {
+	var unit U
+	return d.unmarshalTOML(data, unit.Unit())
+}
+
+func (d *Duration) unmarshalTOML(data interface{}, unit time.Duration) error {
+	switch val := data.(type) {
+	case string:
+		return d.unmarshalText([]byte(val), unit)
+	case int64:
+		if val > math.MaxInt64/int64(unit) || val < math.MinInt64/int64(unit) {
+			return fmt.Errorf("parsing duration '%d': %w", val, errDurationRange)
+		}
+
+		d.Duration = time.Duration(val) * unit
+	case float64:
+		dur, err := scaleFloat(val, unit)
+		if err != nil {
+			return fmt.Errorf("parsing duration '%v': %w", val, err)
+		}
+
+		d.Duration = dur
+	default:
+		return fmt.Errorf("%w: toml type %T: must be a string or number", ErrInvalidDuration, data)
+	}
+
+	return nil
+}
+
+// UnmarshalXMLAttr parses a duration from an XML attribute.
+func (d *Duration) UnmarshalXMLAttr(attr xml.Attr) error {
+	return d.unmarshalText([]byte(attr.Value), time.Second)
+}
+
+// UnmarshalXMLAttr parses a duration from an XML attribute. A number is multiplied by the unit.
+func (d *DurationIn[U]) UnmarshalXMLAttr(attr xml.Attr) error {
+	var unit U
+	return d.unmarshalText([]byte(attr.Value), unit.Unit())
+}
+
+// durationer is a Duration or a DurationIn.
+type durationer interface {
+	duration() time.Duration
+}
+
+// duration returns the time.Duration in a Duration or a DurationIn.
+func (d Duration) duration() time.Duration {
+	return d.Duration
+}
+
+// MarshalText returns the string representation of a Duration. ie. 1m32s or 7d.
 func (d Duration) MarshalText() ([]byte, error) {
-	return []byte(d.Duration.String()), nil
+	return []byte(d.String()), nil
 }
 
 // MarshalJSON returns the string representation of a Duration for JSON. ie. "1m32s".
 func (d Duration) MarshalJSON() ([]byte, error) {
-	return []byte(`"` + d.Duration.String() + `"`), nil
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+// MarshalYAML returns the string representation of a Duration for YAML. ie. 1m32s.
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// MarshalXMLAttr returns the string representation of a Duration as an XML attribute.
+func (d Duration) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	return xml.Attr{Name: name, Value: d.String()}, nil
 }
 
 // String returns a Duration as string without trailing zero units.
+// Durations of one day or longer include a day unit, ie. 7d or 1d12h.
+// The output is always accepted by ParseDuration and UnmarshalText.
 func (d Duration) String() string {
-	dur := d.Duration.String()
+	// Use an unsigned magnitude, so the smallest duration can be printed (it cannot be negated).
+	sign, abs := "", uint64(d.Duration)
+	if d.Duration < 0 {
+		sign, abs = "-", -abs
+	}
+
+	days, rest := abs/uint64(Day), time.Duration(abs%uint64(Day))
+	if days == 0 {
+		return sign + trimDuration(rest.String())
+	}
+
+	if rest == 0 {
+		return fmt.Sprintf("%s%dd", sign, days)
+	}
+
+	return fmt.Sprintf("%s%dd%s", sign, days, trimDuration(rest.String()))
+}
+
+// trimDuration removes trailing zero units from a time.Duration string.
+func trimDuration(dur string) string {
 	if len(dur) > 3 && dur[len(dur)-3:] == "m0s" {
 		dur = dur[:len(dur)-2]
 	}
@@ -52,10 +247,241 @@ func (d Duration) String() string {
 	return dur
 }
 
+// ParseDuration parses a duration string. It accepts everything time.ParseDuration does,
+// plus the d (day) and w (week) units, ie. 7d or 1.5w, and ISO-8601 durations, ie. P1DT12H.
+// ISO-8601 years and months are rejected because their length is ambiguous.
+func ParseDuration(str string) (time.Duration, error) {
+	str = strings.TrimSpace(str)
+	body, neg := trimSign(str)
+
+	if strings.HasPrefix(strings.ToUpper(body), "P") {
+		return parseISO8601(str)
+	}
+
+	if body == "0" {
+		return 0, nil
+	} else if body == "" || durationPart.ReplaceAllString(body, "") != "" {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidDuration, str)
+	}
+
+	var (
+		total uint64 // The magnitude, so the smallest duration can be parsed.
+		err   error
+	)
+
+	for _, part := range durationPart.FindAllStringSubmatch(body, -1) {
+		unit, ok := durationUnits[part[2]]
+		if !ok || strings.Trim(part[1], ".") == "" {
+			return 0, fmt.Errorf("%w: %s", ErrInvalidDuration, str)
+		}
+
+		if total, err = addDecimal(total, part[1], unit); err != nil {
+			return 0, fmt.Errorf("%w: %s", err, str)
+		}
+	}
+
+	dur, err := signDuration(total, neg)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", err, str)
+	}
+
+	return dur, nil
+}
+
+// trimSign removes one optional leading sign from a number. Returns true if the sign is negative.
+func trimSign(str string) (string, bool) {
+	if strings.HasPrefix(str, "+") || strings.HasPrefix(str, "-") {
+		return str[1:], str[0] == '-'
+	}
+
+	return str, false
+}
+
+// durationPart matches one number and unit in a duration string. Like time.ParseDuration,
+// the number may begin or end with a dot, ie. .5h or 1.h, but it must have a digit.
+var durationPart = regexp.MustCompile(`([0-9]*\.?[0-9]*)([a-zµμ]+)`)
+
+// durationUnits are the units ParseDuration accepts: the time.ParseDuration units, days and weeks.
+var durationUnits = map[string]uint64{ //nolint:gochecknoglobals
+	"ns": uint64(time.Nanosecond),
+	"us": uint64(time.Microsecond),
+	"µs": uint64(time.Microsecond), // U+00B5 = micro symbol.
+	"μs": uint64(time.Microsecond), // U+03BC = Greek letter mu.
+	"ms": uint64(time.Millisecond),
+	"s":  uint64(time.Second),
+	"m":  uint64(time.Minute),
+	"h":  uint64(time.Hour),
+	"d":  uint64(Day),
+	"w":  uint64(Week),
+}
+
+// isoDuration matches an ISO-8601 duration. Years and months are captured so they can be rejected.
+var isoDuration = regexp.MustCompile(`^([-+]?)P(?:([0-9.,]+)Y)?(?:([0-9.,]+)M)?(?:([0-9.,]+)W)?(?:([0-9.,]+)D)?` +
+	`(?:T(?:([0-9.,]+)H)?(?:([0-9.,]+)M)?(?:([0-9.,]+)S)?)?$`)
+
+// parseISO8601 parses an ISO-8601 duration, ie. P1W, P1DT12H or PT1.5S.
+func parseISO8601(str string) (time.Duration, error) {
+	upper := strings.ToUpper(str)
+
+	match := isoDuration.FindStringSubmatch(upper)
+	if match == nil || strings.HasSuffix(upper, "T") || strings.HasSuffix(upper, "P") {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidDuration, str)
+	}
+
+	if match[2] != "" || match[3] != "" {
+		return 0, fmt.Errorf("%w: years and months are ambiguous: %s", ErrInvalidDuration, str)
+	}
+
+	var (
+		total uint64
+		err   error
+	)
+
+	for idx, unit := range []time.Duration{Week, Day, time.Hour, time.Minute, time.Second} {
+		if num := strings.Replace(match[idx+4], ",", ".", 1); num != "" {
+			if strings.Count(num, ".") > 1 {
+				return 0, fmt.Errorf("%w: %s", ErrInvalidDuration, str)
+			}
+
+			if total, err = addDecimal(total, num, uint64(unit)); err != nil {
+				return 0, fmt.Errorf("%w: %s", err, str)
+			}
+		}
+	}
+
+	dur, err := signDuration(total, match[1] == "-")
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", err, str)
+	}
+
+	return dur, nil
+}
+
+// numberPart matches a plain decimal number without a unit.
+var numberPart = regexp.MustCompile(`^[-+]?([0-9]*\.)?[0-9]+$`)
+
+// parseNumber converts a plain number (without a unit) into a duration by multiplying it with a unit.
+// Returns false if the string is not a number, and an error if the number is out of range or not finite.
+func parseNumber(str string, unit time.Duration) (time.Duration, bool, error) {
+	str = strings.TrimSpace(str)
+
+	if numberPart.MatchString(str) {
+		body, neg := trimSign(str)
+
+		total, err := scaleDecimal(body, uint64(unit))
+		if err != nil {
+			return 0, true, err
+		}
+
+		dur, err := signDuration(total, neg)
+
+		return dur, true, err
+	}
+
+	// Catch exponents and other formats ParseFloat understands.
+	num, err := strconv.ParseFloat(str, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, false, nil
+	}
+
+	dur, err := scaleFloat(num, unit)
+
+	return dur, true, err
+}
+
+// scaleFloat multiplies a number by a unit. Returns an error if the result is not finite or out of range.
+func scaleFloat(num float64, unit time.Duration) (time.Duration, error) {
+	dur := num * float64(unit)
+	if math.IsNaN(dur) || dur >= math.MaxInt64 || dur < math.MinInt64 {
+		return 0, errDurationRange
+	}
+
+	return time.Duration(dur), nil
+}
+
+// errDurationRange is returned when a duration does not fit in a time.Duration.
+var errDurationRange = fmt.Errorf("%w: out of range", ErrInvalidDuration)
+
+// signDuration converts the magnitude of a duration into a duration. A negative duration may be
+// one nanosecond longer than a positive one, so the smallest duration (and its String) can be parsed.
+func signDuration(total uint64, neg bool) (time.Duration, error) {
+	switch {
+	case neg && total <= 1<<63:
+		return time.Duration(-total), nil
+	case !neg && total <= math.MaxInt64:
+		return time.Duration(total), nil
+	default:
+		return 0, errDurationRange
+	}
+}
+
+// addDecimal adds a decimal string multiplied by a unit to a magnitude. Returns an error if the result overflows.
+func addDecimal(total uint64, num string, unit uint64) (uint64, error) {
+	dur, err := scaleDecimal(num, unit)
+	if err != nil {
+		return 0, err
+	}
+
+	return addDuration(total, dur)
+}
+
+// addDuration adds two magnitudes. Returns an error if the result overflows.
+func addDuration(total, dur uint64) (uint64, error) {
+	sum, carry := bits.Add64(total, dur, 0)
+	if carry != 0 {
+		return 0, errDurationRange
+	}
+
+	return sum, nil
+}
+
+// scaleDecimal multiplies a decimal string by a unit without losing precision to floating point math.
+// Returns the magnitude, or an error if the result does not fit in a uint64.
+func scaleDecimal(num string, unit uint64) (uint64, error) {
+	whole, frac, _ := strings.Cut(num, ".")
+
+	var total uint64
+
+	for _, digit := range whole {
+		if total > (math.MaxUint64-uint64(digit-'0'))/10 { //nolint:mnd
+			return 0, errDurationRange
+		}
+
+		total = total*10 + uint64(digit-'0') //nolint:mnd
+	}
+
+	high, total := bits.Mul64(total, unit)
+	if high != 0 {
+		return 0, errDurationRange
+	}
+
+	for _, digit := range frac {
+		unit /= 10 //nolint:mnd
+
+		var err error
+		if total, err = addDuration(total, uint64(digit-'0')*unit); err != nil {
+			return 0, err
+		}
+	}
+
+	return total, nil
+}
+
 // Make sure our struct satisfies the interface it's for.
 var (
 	_ encoding.TextUnmarshaler = (*Duration)(nil)
 	_ encoding.TextMarshaler   = (*Duration)(nil)
 	_ json.Marshaler           = (*Duration)(nil)
+	_ json.Unmarshaler         = (*Duration)(nil)
+	_ yaml.Marshaler           = (*Duration)(nil)
+	_ yaml.Unmarshaler         = (*Duration)(nil)
+	_ toml.Unmarshaler         = (*Duration)(nil)
+	_ xml.MarshalerAttr        = (*Duration)(nil)
+	_ xml.UnmarshalerAttr      = (*Duration)(nil)
 	_ fmt.Stringer             = (*Duration)(nil)
+	_ encoding.TextUnmarshaler = (*DurationIn[Milliseconds])(nil)
+	_ json.Unmarshaler         = (*DurationIn[Milliseconds])(nil)
+	_ yaml.Unmarshaler         = (*DurationIn[Milliseconds])(nil)
+	_ toml.Unmarshaler         = (*DurationIn[Milliseconds])(nil)
+	_ xml.UnmarshalerAttr      = (*DurationIn[Milliseconds])(nil)
 )
@@ -0,0 +1,203 @@
+package cnfgfile_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"math"
+	"testing"
+	"time"
+
+	toml "github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+	yaml "gopkg.in/yaml.v3"
+)
+
+func TestParseDuration(t *testing.T) {
+	t.Parallel()
+
+	for input, expect := range map[string]time.Duration{
+		"0":                         0,
+		"1m32s":                     time.Minute + 32*time.Second,
+		"7d":                        7 * cnfgfile.Day,
+		"2w":                        2 * cnfgfile.Week,
+		"1.5d":                      36 * time.Hour,
+		"1w2d12h":                   9*cnfgfile.Day + 12*time.Hour,
+		"-1d12h":                    -36 * time.Hour,
+		"1d500ms":                   cnfgfile.Day + 500*time.Millisecond,
+		"P1DT12H":                   36 * time.Hour,
+		"p1w":                       cnfgfile.Week,
+		"PT1.5S":                    1500 * time.Millisecond,
+		"PT0,5M":                    30 * time.Second,
+		"-PT10M":                    -10 * time.Minute,
+		"P2W3DT4H5M6S":              17*cnfgfile.Day + 4*time.Hour + 5*time.Minute + 6*time.Second,
+		"1.h":                       time.Hour,
+		".5h":                       30 * time.Minute,
+		"1µs2μs3us":                 6 * time.Microsecond,
+		"-2562047h47m16.854775808s": math.MinInt64,
+	} {
+		dur, err := cnfgfile.ParseDuration(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, expect, dur, input)
+	}
+
+	for _, input := range []string{"", "d", "7days", "1x", "5 m", "P", "PT", "P1DT", "P1Y", "P1M", "P1.2.3D", ".h", "1..5h",
+		"--1d", "+-1d", "--P1D", "20000w", "P20000W", "300000d", "106751d23h47m16.854775808s", "99999999999999999999d"} {
+		_, err := cnfgfile.ParseDuration(input)
+		require.ErrorIs(t, err, cnfgfile.ErrInvalidDuration, input)
+	}
+}
+
+func TestDurationString(t *testing.T) {
+	t.Parallel()
+
+	for expect, dur := range map[string]time.Duration{
+		"0s":        0,
+		"1m":        time.Minute,
+		"1h":        time.Hour,
+		"1h30m":     90 * time.Minute,
+		"7d":        cnfgfile.Week,
+		"1d12h":     36 * time.Hour,
+		"1d1m5s":    cnfgfile.Day + 65*time.Second,
+		"-2d":       -2 * cnfgfile.Day,
+		"1d500ms":   cnfgfile.Day + 500*time.Millisecond,
+		"1.5s":      1500 * time.Millisecond,
+		"365d1ns":   365*cnfgfile.Day + 1,
+		"-1h2m3.4s": -(time.Hour + 2*time.Minute + 3400*time.Millisecond),
+	} {
+		assert.Equal(t, expect, cnfgfile.Duration{Duration: dur}.String())
+
+		// Make sure every string round-trips.
+		var parsed cnfgfile.Duration
+		require.NoError(t, parsed.UnmarshalText([]byte(expect)), expect)
+		assert.Equal(t, dur, parsed.Duration, expect)
+	}
+
+	for expect, dur := range map[string]time.Duration{
+		"-106751d23h47m16.854775808s": math.MinInt64,
+		"106751d23h47m16.854775807s":  math.MaxInt64,
+	} {
+		assert.Equal(t, expect, cnfgfile.Duration{Duration: dur}.String())
+
+		parsed, err := cnfgfile.ParseDuration(expect)
+		require.NoError(t, err, expect)
+		assert.Equal(t, dur, parsed, "the smallest and largest durations must round-trip")
+	}
+}
+
+type durationStruct struct {
+	XMLName xml.Name          `json:"-"    toml:"-"    xml:"config"    yaml:"-"`
+	Attr    cnfgfile.Duration `json:"attr" toml:"attr" xml:"attr,attr" yaml:"attr"`
+	Elem    cnfgfile.Duration `json:"elem" toml:"elem" xml:"elem"      yaml:"elem"`
+}
+
+func TestDurationNumbers(t *testing.T) {
+	t.Parallel()
+
+	for name, input := range map[string]string{
+		"json": `{"attr": 30, "elem": 1.5}`,
+		"toml": "attr = 30\nelem = 1.5\n",
+		"yaml": "attr: 30\nelem: 1.5\n",
+		"xml":  `<config attr="30"><elem>1.5</elem></config>`,
+	} {
+		config := durationStruct{}
+		require.NoError(t, unmarshalFormat(name, []byte(input), &config), name)
+		assert.Equal(t, 30*time.Second, config.Attr.Duration, name)
+		assert.Equal(t, 1500*time.Millisecond, config.Elem.Duration, name)
+	}
+
+	var dur cnfgfile.Duration
+	require.NoError(t, dur.UnmarshalText([]byte("-2")))
+	assert.Equal(t, -2*time.Second, dur.Duration)
+	require.NoError(t, dur.UnmarshalJSON([]byte("1e2")))
+	assert.Equal(t, 100*time.Second, dur.Duration)
+	require.Error(t, dur.UnmarshalText([]byte("NaN")))
+	require.NoError(t, dur.UnmarshalJSON([]byte("null")), "null must be ignored")
+	assert.Equal(t, 100*time.Second, dur.Duration, "null must not change the duration")
+
+	for _, input := range []string{"1e30", "-1e30", "Inf", "1e400", "99999999999999999999"} {
+		require.ErrorIs(t, dur.UnmarshalJSON([]byte(input)), cnfgfile.ErrInvalidDuration, input)
+	}
+
+	require.ErrorIs(t, dur.UnmarshalTOML(1e30), cnfgfile.ErrInvalidDuration)
+	require.ErrorIs(t, dur.UnmarshalTOML(int64(1e18)), cnfgfile.ErrInvalidDuration)
+	assert.Equal(t, 100*time.Second, dur.Duration, "errors must not change the duration")
+}
+
+func TestDurationIn(t *testing.T) {
+	t.Parallel()
+
+	type unitStruct struct {
+		XMLName xml.Name                                   `json:"-"    toml:"-"    xml:"config"    yaml:"-"`
+		Attr    cnfgfile.DurationIn[cnfgfile.Milliseconds] `json:"attr" toml:"attr" xml:"attr,attr" yaml:"attr"`
+		Elem    cnfgfile.DurationIn[cnfgfile.Minutes]      `json:"elem" toml:"elem" xml:"elem"      yaml:"elem"`
+		Str     cnfgfile.DurationIn[cnfgfile.Hours]        `json:"str"  toml:"str"  xml:"str"       yaml:"str"`
+	}
+
+	for name, input := range map[string]string{
+		"json": `{"attr": 500, "elem": 1.5, "str": "1d"}`,
+		"toml": "attr = 500\nelem = 1.5\nstr = \"1d\"\n",
+		"yaml": "attr: 500\nelem: 1.5\nstr: 1d\n",
+		"xml":  `<config attr="500"><elem>1.5</elem><str>1d</str></config>`,
+	} {
+		config := unitStruct{}
+		require.NoError(t, unmarshalFormat(name, []byte(input), &config), name)
+		assert.Equal(t, 500*time.Millisecond, config.Attr.Duration.Duration, name)
+		assert.Equal(t, 90*time.Second, config.Elem.Duration.Duration, name)
+		assert.Equal(t, cnfgfile.Day, config.Str.Duration.Duration, name, "units in strings are not changed")
+	}
+
+	var dur cnfgfile.DurationIn[cnfgfile.Seconds]
+	require.NoError(t, dur.UnmarshalText([]byte("2")))
+	assert.Equal(t, "2s", dur.String())
+	require.ErrorIs(t, (&cnfgfile.DurationIn[cnfgfile.Hours]{}).UnmarshalTOML(int64(1e13)), cnfgfile.ErrInvalidDuration)
+}
+
+func TestDurationRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	input := durationStruct{
+		Attr: cnfgfile.Duration{Duration: 7 * cnfgfile.Day},
+		Elem: cnfgfile.Duration{Duration: 90 * time.Minute},
+	}
+
+	for _, name := range []string{"json", "toml", "yaml", "xml"} {
+		buf := bytes.Buffer{}
+		require.NoError(t, marshalFormat(name, &buf, input), name)
+		assert.Contains(t, buf.String(), "7d", name)
+		assert.Contains(t, buf.String(), "1h30m", name)
+
+		output := durationStruct{}
+		require.NoError(t, unmarshalFormat(name, buf.Bytes(), &output), name)
+		assert.Equal(t, input.Attr, output.Attr, name)
+		assert.Equal(t, input.Elem, output.Elem, name)
+	}
+}
+
+func unmarshalFormat(format string, data []byte, config interface{}) error {
+	switch format {
+	case "json":
+		return json.Unmarshal(data, config)
+	case "toml":
+		return toml.Unmarshal(data, config)
+	case "yaml":
+		return yaml.Unmarshal(data, config)
+	default:
+		return xml.Unmarshal(data, config)
+	}
+}
+
+func marshalFormat(format string, buf *bytes.Buffer, config interface{}) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(buf).Encode(config)
+	case "toml":
+		return toml.NewEncoder(buf).Encode(config)
+	case "yaml":
+		return yaml.NewEncoder(buf).Encode(config)
+	default:
+		return xml.NewEncoder(buf).Encode(config)
+	}
+}
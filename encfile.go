@@ -0,0 +1,567 @@
+package cnfgfile
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+/*** Encrypted config files keep their keys readable and encrypt every leaf value, like SOPS does. ***/
+/*** The format is our own; it is not compatible with SOPS, and no external tools are required.    ***/
+
+// EncryptedFileKey is the top level key that holds the metadata of an encrypted config file.
+// Unmarshal decrypts a JSON, YAML or TOML file if this key contains a map with a supported
+// version, a MAC and keys. Files with other values in this key are not encrypted.
+const EncryptedFileKey = "cnfgfile"
+
+// Key types in the metadata of an encrypted config file.
+const (
+	fileKeySymmetric = "symmetric"
+	fileKeyX25519    = "x25519"
+	encryptedVersion = 2
+)
+
+// Errors returned while encrypting or decrypting config files.
+var (
+	ErrNoFileKey      = errors.New("none of the provided keys can decrypt the file")
+	ErrMACMismatch    = errors.New("file MAC mismatch; the file was modified")
+	ErrEncryptedValue = errors.New("invalid encrypted value")
+	ErrNoRecipients   = errors.New("must provide at least 1 key or recipient to encrypt for")
+)
+
+// EncryptOpts contains the keys an encrypted config file is encrypted for. Provide at least one.
+// Any one of them (or the private key of a recipient) decrypts the file.
+type EncryptOpts struct {
+	// Keys are symmetric 32 byte keys. Provide the same key in UnmarshalOpts.DecryptKeys to decrypt.
+	Keys [][]byte
+	// Recipients are X25519 public keys. Provide the private key in UnmarshalOpts.DecryptIdentities to decrypt.
+	Recipients []*ecdh.PublicKey
+}
+
+// fileMetadata is stored in an encrypted config file under the EncryptedFileKey.
+type fileMetadata struct {
+	Version int `json:"version"`
+	// MAC is a HMAC-SHA256 of every path, type and plain text value in the file, created with the data key.
+	MAC  string     `json:"mac"`
+	Keys []*fileKey `json:"keys"`
+}
+
+// fileKey is the data key of a file, encrypted with one of the keys the file is encrypted for.
+type fileKey struct {
+	Type string `json:"type"`
+	// ID is a hash of a symmetric key, or a base64 encoded X25519 public key.
+	ID string `json:"id"`
+	// Ephemeral is the base64 encoded ephemeral X25519 public key used to wrap the data key.
+	Ephemeral string `json:"ephemeral,omitempty"`
+	// DataKey is the encrypted data key. It uses the same envelope as encrypted values, ie. enc:AES256GCM:<base64>.
+	DataKey string `json:"data_key"`
+}
+
+// encryptedLeaf matches an encrypted value in an encrypted config file.
+var encryptedLeaf = regexp.MustCompile(`^ENC\[AES256_GCM,data:([^,]*),iv:([^,]+),tag:([^,]+),type:([a-z]+)\]$`)
+
+// EncryptConfig encrypts every value in a JSON, YAML or TOML config file, and keeps the keys readable.
+// The format is chosen by the file name, like Unmarshal does. The output is in the same format, but
+// comments and key order are not kept. Unmarshal decrypts the file when given one of the keys in opts.
+func EncryptConfig(data []byte, fileName string, opts *EncryptOpts) ([]byte, error) {
+	if opts == nil || len(opts.Keys)+len(opts.Recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+
+	format := FormatOf(fileName)
+
+	reader, _, err := deCompress(bytes.NewReader(data), fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := decodeTree(reader, fileName, format)
+	if err != nil {
+		return nil, err
+	}
+
+	top, ok := tree.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: file %s must contain a map", ErrEncryptedValue, fileName)
+	} else if _, ok := top[EncryptedFileKey]; ok {
+		return nil, fmt.Errorf("%w: file %s is already encrypted, or uses the %s key",
+			ErrEncryptedValue, fileName, EncryptedFileKey)
+	}
+
+	dataKey, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &fileMetadata{Version: encryptedVersion}
+
+	if metadata.Keys, err = wrapDataKey(dataKey, opts); err != nil {
+		return nil, err
+	}
+
+	crypt := &fileCrypter{key: dataKey, mac: hmac.New(sha256.New, dataKey), encrypt: true}
+
+	encrypted, err := crypt.walk(top, "")
+	if err != nil {
+		return nil, err
+	}
+
+	metadata.MAC = base64.StdEncoding.EncodeToString(crypt.mac.Sum(nil))
+	output := encrypted.(map[string]interface{}) //nolint:forcetypeassert // walk returns the same type.
+
+	// Convert the metadata to a generic tree, so every format uses the json key names.
+	var generic map[string]interface{}
+	if data, err = json.Marshal(metadata); err == nil {
+		err = json.Unmarshal(data, &generic)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("encoding metadata: %w", err)
+	}
+
+	generic["version"] = metadata.Version // Keep this an integer; json made it a float.
+	output[EncryptedFileKey] = generic
+
+	return EncodeTree(output, format)
+}
+
+// decode decompresses and decrypts a config file (if needed) before it's passed to a decode function.
+// Returns the compression that was detected, and true if the file was encrypted.
+func (u *unmarshaler) decode(reader io.Reader, fileName, format string,
+	decodeFn func(io.Reader, string) error,
+) (string, bool, error) {
+	fileReader, compression, err := deCompress(reader, fileName)
+	if err != nil {
+		return "", false, err
+	}
+
+	fileReader, encrypted, err := u.decrypt(fileReader, fileName, format)
+	if err != nil {
+		return compression, encrypted, err
+	}
+
+	return compression, encrypted, decodeFn(fileReader, format)
+}
+
+// decrypt reads a config file, and returns it decrypted if it's an encrypted config file.
+// Other files are returned as-is. Returns true if the file was encrypted.
+func (u *unmarshaler) decrypt(reader io.Reader, fileName, format string) (io.Reader, bool, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, false, fmt.Errorf("reading file %s: %w", fileName, err)
+	}
+
+	if format == FormatXML || !bytes.Contains(data, []byte(EncryptedFileKey)) {
+		return bytes.NewReader(data), false, nil
+	}
+
+	tree, err := decodeTree(bytes.NewReader(data), fileName, format)
+	if err != nil {
+		return nil, false, err
+	}
+
+	top, _ := tree.(map[string]interface{})
+	if !isEncryptedFile(top) {
+		return bytes.NewReader(data), false, nil
+	}
+
+	plain, err := u.decryptTree(top)
+	if err != nil {
+		return nil, true, fmt.Errorf("decrypting file %s: %w", fileName, err)
+	}
+
+	output, err := EncodeTree(plain, format)
+	if err != nil {
+		return nil, true, err
+	}
+
+	return bytes.NewReader(output), true, nil
+}
+
+// isEncryptedFile returns true if the top level of a file contains our metadata: a map with a version, a MAC
+// and keys. A config that happens to use the EncryptedFileKey for something else is not encrypted.
+func isEncryptedFile(top map[string]interface{}) bool {
+	metadata, ok := top[EncryptedFileKey].(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	for _, key := range []string{"version", "mac", "keys"} {
+		if _, ok := metadata[key]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// decryptTree unwraps the data key, decrypts every value and checks the MAC. The metadata is removed.
+func (u *unmarshaler) decryptTree(top map[string]interface{}) (map[string]interface{}, error) {
+	metadata := &fileMetadata{}
+
+	// The metadata is a generic tree, so convert it with json.
+	if data, err := json.Marshal(top[EncryptedFileKey]); err != nil {
+		return nil, fmt.Errorf("%w: metadata: %w", ErrEncryptedValue, err)
+	} else if err := json.Unmarshal(data, metadata); err != nil {
+		return nil, fmt.Errorf("%w: metadata: %w", ErrEncryptedValue, err)
+	}
+
+	if metadata.Version != encryptedVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d, expected %d",
+			ErrEncryptedValue, metadata.Version, encryptedVersion)
+	}
+
+	dataKey, err := u.unwrapDataKey(metadata.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(top, EncryptedFileKey)
+
+	crypt := &fileCrypter{key: dataKey, mac: hmac.New(sha256.New, dataKey), encrypt: false}
+
+	plain, err := crypt.walk(top, "")
+	if err != nil {
+		return nil, err
+	}
+
+	mac, err := base64.StdEncoding.DecodeString(metadata.MAC)
+	if err != nil || !hmac.Equal(mac, crypt.mac.Sum(nil)) {
+		return nil, ErrMACMismatch
+	}
+
+	return plain.(map[string]interface{}), nil //nolint:forcetypeassert // walk returns the same type.
+}
+
+// wrapDataKey encrypts the data key with every key and recipient.
+func wrapDataKey(dataKey []byte, opts *EncryptOpts) ([]*fileKey, error) {
+	keys := []*fileKey{}
+
+	for _, key := range opts.Keys {
+		wrapped, err := Encrypt(CipherAES256GCM, key, string(dataKey))
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &fileKey{Type: fileKeySymmetric, ID: symmetricKeyID(key), DataKey: wrapped})
+	}
+
+	for _, recipient := range opts.Recipients {
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("generating ephemeral key: %w", err)
+		}
+
+		shared, err := ephemeral.ECDH(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("x25519 key exchange: %w", err)
+		}
+
+		wrapKey := x25519WrapKey(shared, ephemeral.PublicKey(), recipient)
+
+		wrapped, err := Encrypt(CipherAES256GCM, wrapKey, string(dataKey))
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &fileKey{
+			Type:      fileKeyX25519,
+			ID:        base64.StdEncoding.EncodeToString(recipient.Bytes()),
+			Ephemeral: base64.StdEncoding.EncodeToString(ephemeral.PublicKey().Bytes()),
+			DataKey:   wrapped,
+		})
+	}
+
+	return keys, nil
+}
+
+// unwrapDataKey decrypts the data key with the first provided key that the file was encrypted for.
+func (u *unmarshaler) unwrapDataKey(keys []*fileKey) ([]byte, error) {
+	for _, wrapped := range keys {
+		switch wrapped.Type {
+		case fileKeySymmetric:
+			for _, key := range u.DecryptKeys {
+				if symmetricKeyID(key) == wrapped.ID {
+					return unwrapKey(key, wrapped.DataKey)
+				}
+			}
+		case fileKeyX25519:
+			for _, identity := range u.DecryptIdentities {
+				if base64.StdEncoding.EncodeToString(identity.PublicKey().Bytes()) != wrapped.ID {
+					continue
+				}
+
+				ephemeral, err := base64.StdEncoding.DecodeString(wrapped.Ephemeral)
+				if err != nil {
+					return nil, fmt.Errorf("%w: ephemeral key: %w", ErrEncryptedValue, err)
+				}
+
+				public, err := ecdh.X25519().NewPublicKey(ephemeral)
+				if err != nil {
+					return nil, fmt.Errorf("%w: ephemeral key: %w", ErrEncryptedValue, err)
+				}
+
+				shared, err := identity.ECDH(public)
+				if err != nil {
+					return nil, fmt.Errorf("x25519 key exchange: %w", err)
+				}
+
+				return unwrapKey(x25519WrapKey(shared, public, identity.PublicKey()), wrapped.DataKey)
+			}
+		}
+	}
+
+	return nil, ErrNoFileKey
+}
+
+// unwrapKey decrypts a data key.
+func unwrapKey(key []byte, wrapped string) ([]byte, error) {
+	dataKey, err := Decrypt(wrapped, key)
+	if err != nil {
+		return nil, fmt.Errorf("data key: %w", err)
+	} else if len(dataKey) != EncryptionKeySize {
+		return nil, fmt.Errorf("%w: data key size", ErrInvalidKey)
+	}
+
+	return []byte(dataKey), nil
+}
+
+// symmetricKeyID identifies a symmetric key without revealing it.
+func symmetricKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// x25519WrapKey derives the key that wraps a data key from a shared X25519 secret.
+// The ephemeral public key and the recipient's public key are the HKDF salt.
+func x25519WrapKey(shared []byte, ephemeral, recipient *ecdh.PublicKey) []byte {
+	salt := append(append([]byte{}, ephemeral.Bytes()...), recipient.Bytes()...)
+	return hkdfSHA256(shared, salt, []byte("golift.io/cnfgfile x25519"))
+}
+
+// hkdfSHA256 returns 32 bytes of HKDF-SHA256 output (RFC 5869). One block is all we need.
+func hkdfSHA256(secret, salt, info []byte) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write(info)
+	expand.Write([]byte{1})
+
+	return expand.Sum(nil)
+}
+
+// fileCrypter encrypts or decrypts every leaf value in a generic tree, and adds them to a MAC.
+type fileCrypter struct {
+	key     []byte
+	mac     hash.Hash
+	encrypt bool
+}
+
+// walk returns a copy of a generic tree with every leaf encrypted (or decrypted). Map keys are
+// walked in sorted order, so the MAC does not depend on the order of the keys in the file.
+// The path of each leaf is authenticated with its value, so values cannot be moved around.
+// Each map key in a path is prefixed with its length, and list indexes are in brackets, so two
+// different paths never produce the same string. Maps and lists are authenticated with their length.
+func (c *fileCrypter) walk(node interface{}, path string) (interface{}, error) {
+	switch val := node.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+		c.sum(path, "map", strconv.Itoa(len(keys)))
+
+		output := make(map[string]interface{}, len(val))
+
+		for _, key := range keys {
+			var err error
+			if output[key], err = c.walk(val[key], path+strconv.Itoa(len(key))+":"+key); err != nil {
+				return nil, err
+			}
+		}
+
+		return output, nil
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(val))
+		for key, value := range val {
+			converted[fmt.Sprint(key)] = value
+		}
+
+		return c.walk(converted, path)
+	case []interface{}:
+		output := make([]interface{}, len(val))
+		c.sum(path, "list", strconv.Itoa(len(val)))
+
+		for idx := range val {
+			var err error
+			if output[idx], err = c.walk(val[idx], path+"["+strconv.Itoa(idx)+"]"); err != nil {
+				return nil, err
+			}
+		}
+
+		return output, nil
+	case []map[string]interface{}: // TOML arrays of tables.
+		output := make([]interface{}, len(val))
+		for idx := range val {
+			output[idx] = val[idx]
+		}
+
+		return c.walk(output, path)
+	case nil:
+		c.sum(path, "null", "")
+		return nil, nil
+	}
+
+	if c.encrypt {
+		return c.encryptLeaf(node, path)
+	}
+
+	return c.decryptLeaf(node, path)
+}
+
+// sum adds a leaf (or the length of a map or list) to the MAC. Each part is prefixed with its length.
+func (c *fileCrypter) sum(path, valType, value string) {
+	for _, part := range []string{path, valType, value} {
+		c.mac.Write(binary.BigEndian.AppendUint64(nil, uint64(len(part))))
+		c.mac.Write([]byte(part))
+	}
+}
+
+// encryptLeaf encrypts a single value, and keeps its type.
+func (c *fileCrypter) encryptLeaf(node interface{}, path string) (string, error) {
+	valType, value, err := leafString(node)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+
+	c.sum(path, valType, value)
+
+	aead, err := newGCM(c.key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nil, nonce, []byte(value), []byte(path))
+	data, tag := sealed[:len(sealed)-aead.Overhead()], sealed[len(sealed)-aead.Overhead():]
+	encode := base64.StdEncoding.EncodeToString
+
+	return "ENC[AES256_GCM,data:" + encode(data) + ",iv:" + encode(nonce) +
+		",tag:" + encode(tag) + ",type:" + valType + "]", nil
+}
+
+// decryptLeaf decrypts a single value, and restores its type.
+func (c *fileCrypter) decryptLeaf(node interface{}, path string) (interface{}, error) {
+	str, _ := node.(string)
+
+	match := encryptedLeaf.FindStringSubmatch(str)
+	if match == nil {
+		valType, value, err := leafString(node)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		c.sum(path, valType, value) // Unencrypted values are still authenticated.
+
+		return node, nil
+	}
+
+	parts := make([][]byte, 3) //nolint:mnd
+
+	for idx := range parts {
+		var err error
+		if parts[idx], err = base64.StdEncoding.DecodeString(match[idx+1]); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrEncryptedValue, path, err)
+		}
+	}
+
+	aead, err := newGCM(c.key)
+	if err != nil {
+		return nil, err
+	} else if len(parts[1]) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: %s: iv size", ErrEncryptedValue, path)
+	}
+
+	plain, err := aead.Open(nil, parts[1], append(parts[0], parts[2]...), []byte(path))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrDecrypt, path, err)
+	}
+
+	c.sum(path, match[4], string(plain))
+
+	return typedLeaf(match[4], string(plain), path)
+}
+
+// leafString returns the type and string representation of a leaf value.
+func leafString(node interface{}) (string, string, error) {
+	switch val := node.(type) {
+	case string:
+		return "str", val, nil
+	case bool:
+		return "bool", strconv.FormatBool(val), nil
+	case int:
+		return "int", strconv.Itoa(val), nil
+	case int64:
+		return "int", strconv.FormatInt(val, 10), nil //nolint:mnd
+	case uint64:
+		return "int", strconv.FormatUint(val, 10), nil //nolint:mnd
+	case float64:
+		return "float", strconv.FormatFloat(val, 'g', -1, 64), nil //nolint:mnd
+	case time.Time:
+		return "time", val.Format(time.RFC3339Nano), nil
+	default:
+		return "", "", fmt.Errorf("%w: unsupported type %T", ErrEncryptedValue, node)
+	}
+}
+
+// typedLeaf converts a decrypted value back to its original type.
+func typedLeaf(valType, value, path string) (interface{}, error) {
+	var (
+		output interface{}
+		err    error
+	)
+
+	switch valType {
+	case "str":
+		return value, nil
+	case "bool":
+		output, err = strconv.ParseBool(value)
+	case "int":
+		if output, err = strconv.ParseInt(value, 10, 64); err != nil { //nolint:mnd
+			output, err = strconv.ParseUint(value, 10, 64) //nolint:mnd
+		}
+	case "float":
+		output, err = strconv.ParseFloat(value, 64) //nolint:mnd
+	case "time":
+		output, err = time.Parse(time.RFC3339Nano, value)
+	default:
+		err = ErrUnsupportedType
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: type %s: %w", ErrEncryptedValue, path, valType, err)
+	}
+
+	return output, nil
+}
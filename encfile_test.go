@@ -0,0 +1,158 @@
+package cnfgfile_test
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+func TestEncryptConfig(t *testing.T) {
+	t.Parallel()
+
+	key, err := cnfgfile.GenerateKey()
+	require.NoError(t, err)
+	identity, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	opts := &cnfgfile.EncryptOpts{Keys: [][]byte{key}, Recipients: []*ecdh.PublicKey{identity.PublicKey()}}
+
+	for _, name := range []string{"config.json", "config.yaml", "config.toml", "config.json.gz"} {
+		data, err := os.ReadFile("tests/" + name)
+		require.NoError(t, err)
+
+		encrypted, err := cnfgfile.EncryptConfig(data, name, opts)
+		require.NoError(t, err, name)
+		assert.Contains(t, string(encrypted), "pstruct", "keys must remain readable")
+		assert.NotContains(t, string(encrypted), "foo2", "values must be encrypted")
+		assert.NotContains(t, string(encrypted), "123.4567", "values must be encrypted")
+
+		file := writeFile(t, name, encrypted)
+
+		config := &testStruct{}
+		_, err = cnfgfile.UnmarshalWith(config, &cnfgfile.UnmarshalOpts{DecryptKeys: [][]byte{key}}, file)
+		testUnmarshalValues(t, assert.New(t), config, err, name+" symmetric")
+
+		config = &testStruct{}
+		_, err = cnfgfile.UnmarshalWith(config, &cnfgfile.UnmarshalOpts{
+			DecryptIdentities: []*ecdh.PrivateKey{identity},
+		}, file)
+		testUnmarshalValues(t, assert.New(t), config, err, name+" x25519")
+
+		err = cnfgfile.Unmarshal(&testStruct{}, file)
+		require.ErrorIs(t, err, cnfgfile.ErrNoFileKey, name)
+
+		_, err = cnfgfile.EncryptConfig(encrypted, name, opts)
+		require.ErrorIs(t, err, cnfgfile.ErrEncryptedValue, "encrypted files must not be encrypted twice")
+	}
+
+	_, err = cnfgfile.EncryptConfig([]byte(`{"a":"b"}`), "config.json", nil)
+	require.ErrorIs(t, err, cnfgfile.ErrNoRecipients)
+}
+
+func TestDecryptConfigTampered(t *testing.T) {
+	t.Parallel()
+
+	key, err := cnfgfile.GenerateKey()
+	require.NoError(t, err)
+
+	data, err := os.ReadFile("tests/config.json")
+	require.NoError(t, err)
+
+	encrypted, err := cnfgfile.EncryptConfig(data, "config.json", &cnfgfile.EncryptOpts{Keys: [][]byte{key}})
+	require.NoError(t, err)
+
+	opts := &cnfgfile.UnmarshalOpts{DecryptKeys: [][]byte{key}}
+	tamper := func(change func(tree map[string]interface{})) error {
+		tree := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(encrypted, &tree))
+		change(tree)
+
+		data, err := json.Marshal(tree)
+		require.NoError(t, err)
+
+		_, err = cnfgfile.UnmarshalWith(&testStruct{}, opts, writeFile(t, "config.json", data))
+
+		return err
+	}
+
+	err = tamper(func(tree map[string]interface{}) { delete(tree, "struct") })
+	require.ErrorIs(t, err, cnfgfile.ErrMACMismatch, "removing a value must be detected")
+
+	err = tamper(func(tree map[string]interface{}) { tree["extra"] = "plain" })
+	require.ErrorIs(t, err, cnfgfile.ErrMACMismatch, "adding a plain value must be detected")
+
+	err = tamper(func(tree map[string]interface{}) {
+		pstruct, _ := tree["pstruct"].(map[string]interface{})
+		tree["other"] = map[string]interface{}{"string": pstruct["string"]}
+		delete(tree, "pstruct")
+	})
+	require.ErrorIs(t, err, cnfgfile.ErrDecrypt, "moving a value must be detected")
+}
+
+func TestDecryptConfigStructure(t *testing.T) {
+	t.Parallel()
+
+	key, err := cnfgfile.GenerateKey()
+	require.NoError(t, err)
+
+	input := []byte(`{"a:b":{"c":"1"},"a":{"b:c":"2"},"empty":{},"list":[]}`)
+	encrypted, err := cnfgfile.EncryptConfig(input, "config.json", &cnfgfile.EncryptOpts{Keys: [][]byte{key}})
+	require.NoError(t, err)
+
+	opts := &cnfgfile.UnmarshalOpts{DecryptKeys: [][]byte{key}}
+	tamper := func(change func(tree map[string]interface{})) error {
+		tree := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(encrypted, &tree))
+		change(tree)
+
+		data, err := json.Marshal(tree)
+		require.NoError(t, err)
+
+		config := map[string]interface{}{}
+		_, err = cnfgfile.UnmarshalWith(&config, opts, writeFile(t, "config.json", data))
+
+		return err
+	}
+
+	require.NoError(t, tamper(func(map[string]interface{}) {}))
+
+	err = tamper(func(tree map[string]interface{}) {
+		first, _ := tree["a:b"].(map[string]interface{})
+		second, _ := tree["a"].(map[string]interface{})
+		first["c"], second["b:c"] = second["b:c"], first["c"]
+	})
+	require.Error(t, err, "swapping values between paths that join to the same string must be detected")
+
+	err = tamper(func(tree map[string]interface{}) { tree["empty"] = map[string]interface{}{"new": nil} })
+	require.ErrorIs(t, err, cnfgfile.ErrMACMismatch, "adding to an empty map must be detected")
+
+	err = tamper(func(tree map[string]interface{}) { tree["list"] = map[string]interface{}{} })
+	require.ErrorIs(t, err, cnfgfile.ErrMACMismatch, "changing an empty list to a map must be detected")
+
+	err = tamper(func(tree map[string]interface{}) { delete(tree, "empty") })
+	require.ErrorIs(t, err, cnfgfile.ErrMACMismatch, "removing an empty map must be detected")
+}
+
+func TestDecryptConfigMarker(t *testing.T) {
+	t.Parallel()
+
+	config := &struct {
+		Cnfgfile string `json:"cnfgfile"`
+		Name     string `json:"name"`
+	}{}
+
+	file := writeFile(t, "config.json", []byte(`{"cnfgfile": "not encrypted", "name": "app"}`))
+	require.NoError(t, cnfgfile.Unmarshal(config, file), "a plain cnfgfile key must not be treated as encrypted")
+	assert.Equal(t, "not encrypted", config.Cnfgfile)
+	assert.Equal(t, "app", config.Name)
+
+	file = writeFile(t, "config.json", []byte(`{"cnfgfile": {"version": 99, "mac": "", "keys": []}}`))
+	_, err := cnfgfile.UnmarshalWith(&struct{}{}, &cnfgfile.UnmarshalOpts{}, file)
+	require.ErrorIs(t, err, cnfgfile.ErrEncryptedValue, "unsupported versions must return an error")
+}
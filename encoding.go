@@ -0,0 +1,81 @@
+package cnfgfile
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// ErrUnknownEncoding is returned when a reference uses an encoding that is not supported.
+var ErrUnknownEncoding = errors.New("unknown encoding")
+
+// Encodings that may be added to the prefix to decode a referenced file, ie. filepath+base64:/run/secrets/cert.
+const (
+	EncodingBase64    = "base64"
+	EncodingBase64URL = "base64url"
+	EncodingHex       = "hex"
+)
+
+// cutPrefix removes our prefix from a string, and returns the encoding if the prefix included one.
+// The prefix filepath: also matches filepath+base64: and filepath+hex:. Returns false if the prefix is missing.
+func (p *parser) cutPrefix(value string) (string, string, bool) {
+	if rest, ok := strings.CutPrefix(value, p.Prefix); ok {
+		return rest, "", true
+	}
+
+	rest, ok := strings.CutPrefix(value, strings.TrimSuffix(p.Prefix, ":")+"+")
+	if !ok {
+		return "", "", false
+	}
+
+	encoding, rest, ok := strings.Cut(rest, ":")
+	if !ok || strings.ContainsAny(encoding, "/\\ ") {
+		return "", "", false
+	}
+
+	return rest, encoding, true
+}
+
+// decoder wraps a reader with a decoder for the provided encoding. Whitespace is ignored while decoding.
+func decoder(reader io.Reader, encoding string) (io.Reader, error) {
+	switch encoding {
+	case "":
+		return reader, nil
+	case EncodingBase64:
+		return base64.NewDecoder(base64.StdEncoding, &noSpaceReader{reader}), nil
+	case EncodingBase64URL:
+		return base64.NewDecoder(base64.URLEncoding, &noSpaceReader{reader}), nil
+	case EncodingHex:
+		return hex.NewDecoder(&noSpaceReader{reader}), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEncoding, encoding)
+	}
+}
+
+// noSpaceReader removes all whitespace from the data it reads, so encoded files may contain line breaks.
+type noSpaceReader struct {
+	io.Reader
+}
+
+// Read satisfies the io.Reader interface.
+func (r *noSpaceReader) Read(data []byte) (int, error) {
+	for {
+		size, err := r.Reader.Read(data)
+
+		kept := 0
+		for _, char := range data[:size] {
+			if !unicode.IsSpace(rune(char)) {
+				data[kept] = char
+				kept++
+			}
+		}
+
+		if kept > 0 || err != nil {
+			return kept, err //nolint:wrapcheck // This is a reader, do not wrap io.EOF.
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package cnfgfile_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+// writeFile creates a file in a temporary directory and returns its path.
+func writeFile(t *testing.T, name string, content []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+
+	return path
+}
+
+// gzipData compresses data with gzip.
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	return buf.Bytes()
+}
+
+func TestParseEncoded(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("binary\x00secret\xff")
+	encoded := base64.StdEncoding.EncodeToString(secret)
+	// Line breaks in encoded files are ignored.
+	wrapped := encoded[:8] + "\n" + encoded[8:] + "\n"
+
+	data := &struct {
+		Gzip      string
+		Bzip2     string
+		Base64    string
+		Base64URL string
+		Hex       string
+		GzBase64  string
+		Empty     string
+		Fallback  string
+		Plain     string
+	}{
+		Gzip:      "filepath:" + writeFile(t, "secret.gz", gzipData(t, []byte("compressed secret\n"))),
+		Bzip2:     "filepath:tests/config.yaml.bz2",
+		Base64:    "filepath+base64:" + writeFile(t, "b64", []byte(wrapped)),
+		Base64URL: "filepath+base64url:" + writeFile(t, "b64url", []byte(base64.URLEncoding.EncodeToString(secret))),
+		Hex:       "filepath+hex:" + writeFile(t, "hex", []byte(hex.EncodeToString(secret))),
+		GzBase64:  "filepath+base64:" + writeFile(t, "secret.b64.gz", gzipData(t, []byte(encoded))),
+		Empty:     "filepath+hex:" + writeFile(t, "empty", nil),
+		Fallback:  "filepath:/no_file|filepath+hex:" + writeFile(t, "hex2", []byte("6869")),
+		Plain:     "filepath:" + writeFile(t, "token", []byte("BZh91AY&SY")),
+	}
+
+	output, err := cnfgfile.Parse(data, &cnfgfile.Opts{NoTrim: true})
+	require.NoError(t, err)
+	assert.Equal(t, "compressed secret\n", data.Gzip, "gzip files must be decompressed")
+	assert.Contains(t, data.Bzip2, "pstruct:", "bzip2 files must be decompressed")
+	assert.Equal(t, string(secret), data.Base64)
+	assert.Equal(t, string(secret), data.Base64URL)
+	assert.Equal(t, string(secret), data.Hex)
+	assert.Equal(t, string(secret), data.GzBase64, "compressed files must be decompressed before decoding")
+	assert.Empty(t, data.Empty)
+	assert.Equal(t, "hi", data.Fallback, "alternatives may have their own encoding")
+	assert.Equal(t, "BZh91AY&SY", data.Plain, "files without a compressed extension must not be decompressed")
+	assert.Equal(t, "tests/config.yaml.bz2", output["Config.Bzip2"])
+	assert.NotContains(t, output["Config.Hex"], "hex:", "the output map must not contain the encoding")
+}
+
+func TestParseEncodedMaxSize(t *testing.T) {
+	t.Parallel()
+
+	bomb := gzipData(t, []byte(strings.Repeat("a", 1024*1024)))
+	data := &struct {
+		Bomb string
+		Hex  string
+	}{
+		Bomb: "filepath:" + writeFile(t, "bomb.gz", bomb),
+		Hex:  "filepath+hex:" + writeFile(t, "hex", []byte("68692c2074686973")),
+	}
+
+	_, err := cnfgfile.Parse(data, &cnfgfile.Opts{MaxSize: 4})
+	require.NoError(t, err)
+	assert.Equal(t, "aaaa", data.Bomb, "MaxSize must apply to the decompressed data")
+	assert.Equal(t, "hi,", data.Hex, "MaxSize must apply to the decoded data")
+}
+
+func TestParseEncodedErrors(t *testing.T) {
+	t.Parallel()
+
+	data := &struct{ Name string }{Name: "filepath+rot13:" + writeFile(t, "file", []byte("secret"))}
+	_, err := cnfgfile.Parse(data, nil)
+	require.ErrorIs(t, err, cnfgfile.ErrUnknownEncoding)
+
+	data.Name = "filepath+hex:" + writeFile(t, "bad", []byte("not hex"))
+	_, err = cnfgfile.Parse(data, nil)
+	require.ErrorContains(t, err, "reading file")
+
+	data.Name = "filepath+base64:/no_file"
+	_, err = cnfgfile.Parse(data, nil)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,202 @@
+package cnfgfile
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// EncryptedPrefix starts every encrypted value, ie. enc:AES256GCM:<base64>.
+const EncryptedPrefix = "enc:"
+
+// Ciphers that may be used to encrypt values. AES256GCM is the only one.
+// AES256GCM values are the base64 encoded 12 byte nonce and the sealed data, and use 32 byte keys.
+// NaCl secretbox is not supported, because it requires golang.org/x/crypto, and this package
+// only depends on the standard library and its config file format packages.
+const (
+	CipherAES256GCM = "AES256GCM"
+	// EncryptionKeySize is the size of the keys used with every cipher.
+	EncryptionKeySize = 32
+)
+
+// Errors returned while encrypting or decrypting values.
+var (
+	ErrInvalidKey    = errors.New("invalid encryption key")
+	ErrUnknownCipher = errors.New("unknown cipher")
+	ErrDecrypt       = errors.New("decrypting value")
+	ErrNoDecryptKey  = errors.New("encrypted value found, but no DecryptKey or DecryptKeyFile provided")
+)
+
+// GenerateKey returns a new random encryption key. Save it with hex.EncodeToString, and provide
+// it to Parse with Opts.DecryptKey or Opts.DecryptKeyFile.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, EncryptionKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generating key: %w", err)
+	}
+
+	return key, nil
+}
+
+// ParseKey returns an encryption key from raw, hex or base64 encoded data, like the content of a key file.
+func ParseKey(data []byte) ([]byte, error) {
+	if len(data) == EncryptionKeySize {
+		return data, nil
+	}
+
+	str := string(bytes.TrimSpace(data))
+
+	if key, err := hex.DecodeString(str); err == nil && len(key) == EncryptionKeySize {
+		return key, nil
+	}
+
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding} {
+		if key, err := encoding.DecodeString(str); err == nil && len(key) == EncryptionKeySize {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: must be %d bytes, raw or hex or base64 encoded", ErrInvalidKey, EncryptionKeySize)
+}
+
+// Encrypt encrypts a value with a cipher and a 32 byte key. The output is ready to use in a config file.
+// It looks like enc:AES256GCM:<base64>, and Parse replaces it with the plain text value.
+func Encrypt(cipherName string, key []byte, plainText string) (string, error) {
+	if len(key) != EncryptionKeySize {
+		return "", fmt.Errorf("%w: must be %d bytes", ErrInvalidKey, EncryptionKeySize)
+	}
+
+	var sealed []byte
+
+	switch cipherName = strings.ToUpper(cipherName); cipherName {
+	case CipherAES256GCM:
+		aead, err := newGCM(key)
+		if err != nil {
+			return "", err
+		}
+
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", fmt.Errorf("generating nonce: %w", err)
+		}
+
+		sealed = aead.Seal(nonce, nonce, []byte(plainText), nil)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownCipher, cipherName)
+	}
+
+	return EncryptedPrefix + cipherName + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value created by Encrypt with the same key. The value must begin with EncryptedPrefix.
+func Decrypt(value string, key []byte) (string, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(value), EncryptedPrefix)
+	cipherName, payload, found := strings.Cut(rest, ":")
+
+	if !ok || !found {
+		return "", fmt.Errorf("%w: missing %s<cipher>: prefix", ErrDecrypt, EncryptedPrefix)
+	}
+
+	if len(key) != EncryptionKeySize {
+		return "", fmt.Errorf("%w: must be %d bytes", ErrInvalidKey, EncryptionKeySize)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		if sealed, err = base64.RawStdEncoding.DecodeString(payload); err != nil {
+			return "", fmt.Errorf("%w: invalid base64: %w", ErrDecrypt, err)
+		}
+	}
+
+	switch strings.ToUpper(cipherName) {
+	case CipherAES256GCM:
+		return openGCM(key, sealed)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownCipher, cipherName)
+	}
+}
+
+// newGCM returns an AES-256-GCM cipher.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating gcm cipher: %w", err)
+	}
+
+	return aead, nil
+}
+
+// openGCM decrypts an AES-256-GCM nonce and sealed data.
+func openGCM(key, sealed []byte) (string, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("%w: value too short", ErrDecrypt)
+	}
+
+	plainText, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: wrong key or corrupt value: %w", ErrDecrypt, err)
+	}
+
+	return string(plainText), nil
+}
+
+// parseEncrypted replaces an encrypted string with its plain text value.
+func (p *parser) parseEncrypted(elem reflect.Value, name string) error {
+	key, err := p.decryptKey()
+	if err == nil {
+		var plainText string
+		if plainText, err = Decrypt(elem.String(), key); err == nil {
+			elem.SetString(plainText)
+			return nil
+		}
+	}
+
+	return &ElemError{Name: name, File: p.DecryptKeyFile, Inner: err}
+}
+
+// isEncrypted returns true if a value begins with enc:<cipher>: and a known cipher.
+// Nothing else is decrypted, so existing values like enc:foo keep working without a key.
+func (p *parser) isEncrypted(value string) bool {
+	rest, ok := strings.CutPrefix(value, EncryptedPrefix)
+	cipherName, _, found := strings.Cut(rest, ":")
+
+	return ok && found && strings.ToUpper(cipherName) == CipherAES256GCM
+}
+
+// decryptKey returns the decryption key, and reads it from the key file the first time it's needed.
+func (p *parser) decryptKey() ([]byte, error) {
+	if len(p.DecryptKey) > 0 {
+		return p.DecryptKey, nil
+	} else if p.DecryptKeyFile == "" {
+		return nil, ErrNoDecryptKey
+	}
+
+	data, err := os.ReadFile(p.DecryptKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+
+	if p.DecryptKey, err = ParseKey(data); err != nil {
+		return nil, fmt.Errorf("key file %s: %w", p.DecryptKeyFile, err)
+	}
+
+	return p.DecryptKey, nil
+}
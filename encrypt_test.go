@@ -0,0 +1,112 @@
+package cnfgfile_test
+
+import (
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+func TestEncrypt(t *testing.T) {
+	t.Parallel()
+
+	key, err := cnfgfile.GenerateKey()
+	require.NoError(t, err)
+
+	for _, cipher := range []string{cnfgfile.CipherAES256GCM, "aes256gcm"} {
+		value, err := cnfgfile.Encrypt(cipher, key, "super secret")
+		require.NoError(t, err, cipher)
+		assert.True(t, strings.HasPrefix(value, "enc:"+strings.ToUpper(cipher)+":"), cipher)
+		assert.NotContains(t, value, "super secret")
+
+		again, err := cnfgfile.Encrypt(cipher, key, "super secret")
+		require.NoError(t, err, cipher)
+		assert.NotEqual(t, value, again, "every value must use a new nonce")
+
+		plain, err := cnfgfile.Decrypt(value, key)
+		require.NoError(t, err, cipher)
+		assert.Equal(t, "super secret", plain, cipher)
+
+		wrong, _ := cnfgfile.GenerateKey()
+		_, err = cnfgfile.Decrypt(value, wrong)
+		require.ErrorIs(t, err, cnfgfile.ErrDecrypt, "the wrong key must not decrypt a value")
+	}
+
+	_, err = cnfgfile.Encrypt("rot13", key, "super secret")
+	require.ErrorIs(t, err, cnfgfile.ErrUnknownCipher)
+	_, err = cnfgfile.Encrypt("SECRETBOX", key, "super secret")
+	require.ErrorIs(t, err, cnfgfile.ErrUnknownCipher)
+	_, err = cnfgfile.Encrypt(cnfgfile.CipherAES256GCM, key[:16], "super secret")
+	require.ErrorIs(t, err, cnfgfile.ErrInvalidKey)
+	_, err = cnfgfile.Decrypt("enc:AES256GCM:AAAA", key)
+	require.ErrorIs(t, err, cnfgfile.ErrDecrypt)
+	_, err = cnfgfile.Decrypt("AES256GCM:AAAA", key)
+	require.ErrorIs(t, err, cnfgfile.ErrDecrypt)
+}
+
+func TestParseEncrypted(t *testing.T) {
+	t.Parallel()
+
+	key, err := cnfgfile.GenerateKey()
+	require.NoError(t, err)
+
+	gcm, _ := cnfgfile.Encrypt(cnfgfile.CipherAES256GCM, key, "gcm secret")
+	box, _ := cnfgfile.Encrypt(cnfgfile.CipherAES256GCM, key, "box secret")
+
+	type config struct {
+		GCM     string
+		Box     cnfgfile.Secret
+		List    []string
+		Map     map[string]string
+		Literal string
+	}
+
+	data := &config{GCM: gcm, Box: cnfgfile.Secret(box), List: []string{box}, Map: map[string]string{"k": gcm}, Literal: "enc"}
+	output, err := cnfgfile.Parse(data, &cnfgfile.Opts{DecryptKey: key})
+	require.NoError(t, err)
+	assert.Equal(t, &config{
+		GCM: "gcm secret", Box: "box secret", List: []string{"box secret"}, Map: map[string]string{"k": "gcm secret"},
+		Literal: "enc",
+	}, data)
+	assert.Empty(t, output, "encrypted values are not files")
+
+	// Use a key file.
+	keyFile := writeFile(t, "key", []byte(hex.EncodeToString(key)+"\n"))
+	data = &config{GCM: gcm}
+	_, err = cnfgfile.Parse(data, &cnfgfile.Opts{DecryptKeyFile: keyFile})
+	require.NoError(t, err)
+	assert.Equal(t, "gcm secret", data.GCM)
+
+	data = &config{GCM: gcm}
+	_, err = cnfgfile.Parse(data, nil)
+	require.ErrorIs(t, err, cnfgfile.ErrNoDecryptKey, "encrypted values must not be used without a key")
+	require.ErrorContains(t, err, "Config.GCM")
+	assert.Equal(t, gcm, data.GCM)
+
+	data = &config{GCM: "enc:foo", Literal: "enc:SECRETBOX:abc"}
+	_, err = cnfgfile.Parse(data, nil)
+	require.NoError(t, err, "values without a known cipher are not encrypted")
+
+	data = &config{GCM: "enc:foo", List: []string{"enc:rot13:abc"}, Literal: "enc:AES256GCM"}
+	_, err = cnfgfile.Parse(data, &cnfgfile.Opts{DecryptKey: key})
+	require.NoError(t, err)
+	assert.Equal(t, &config{GCM: "enc:foo", List: []string{"enc:rot13:abc"}, Literal: "enc:AES256GCM"}, data,
+		"values without a known cipher must be left alone")
+
+	data = &config{GCM: "enc:aes256gcm:AAAA"}
+	_, err = cnfgfile.Parse(data, &cnfgfile.Opts{DecryptKey: key})
+	require.ErrorIs(t, err, cnfgfile.ErrDecrypt)
+	require.ErrorContains(t, err, "Config.GCM")
+
+	data = &config{GCM: gcm}
+	_, err = cnfgfile.Parse(data, &cnfgfile.Opts{DecryptKeyFile: filepath.Join(t.TempDir(), "missing")})
+	require.ErrorContains(t, err, "reading key file")
+
+	data = &config{GCM: gcm}
+	_, err = cnfgfile.Parse(data, &cnfgfile.Opts{DecryptKeyFile: writeFile(t, "short", []byte("abc"))})
+	require.ErrorIs(t, err, cnfgfile.ErrInvalidKey)
+}
@@ -0,0 +1,527 @@
+package cnfgfile
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ExampleSecretPath is the directory used in the placeholder for Secret members, ie. filepath:/run/secrets/password.
+const ExampleSecretPath = "/run/secrets/"
+
+// ExampleMapKey is the key of the example entry added to an empty map of structs.
+const ExampleMapKey = "example"
+
+//nolint:gochecknoglobals
+var (
+	secretType = reflect.TypeOf(Secret(""))
+	tomlBare   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// exampleNode is one value in an example config file.
+type exampleNode struct {
+	key     string
+	comment string
+	// value is a scalar, or a list of scalars, if this is not an object or a list of objects.
+	value interface{}
+	// object is true if this is a struct or a map, and children are its members.
+	object   bool
+	children []*exampleNode
+	// list is true if this is a slice of objects, and items are the objects.
+	list  bool
+	items []*exampleNode
+}
+
+// Example generates a commented example config file from a config struct, in any format: json, yaml, toml
+// or xml. The values in the struct are used, and members with a zero value get the value in their default tag.
+// The desc tag of each member is written as a comment above it. JSON output has // comments (JSONC), so
+// remove them if your JSON parser does not support comments. Empty slices (and maps) of structs get one
+// example entry, so every member is shown. Secret members are never written; unless they already contain
+// a file reference, their value is a placeholder like filepath:/run/secrets/password. XML tags like a>b are
+// written as nested elements, and ErrXMLName is returned if a member or map key is not a valid element name.
+func Example(config interface{}, format string) ([]byte, error) {
+	elem := reflect.ValueOf(config)
+	for elem.IsValid() && elem.Kind() == reflect.Pointer && !elem.IsNil() {
+		elem = elem.Elem()
+	}
+
+	if !elem.IsValid() || elem.Kind() != reflect.Struct {
+		return nil, ErrNotStruct
+	}
+
+	// Work on a copy, so the defaults are not applied to the caller's struct.
+	cfg := reflect.New(elem.Type())
+	cfg.Elem().Set(elem)
+
+	if _, err := SetDefaults(cfg.Interface(), nil); err != nil {
+		return nil, err
+	}
+
+	format = strings.ToLower(format)
+	gen := &exampleGen{format: format, active: map[reflect.Type]bool{}}
+	root := gen.node(cfg.Elem(), "")
+
+	var buf strings.Builder
+
+	switch format {
+	case FormatTOML:
+		writeTOMLExample(&buf, root, nil)
+	case FormatYAML:
+		writeYAMLExample(&buf, root.children, "")
+	case FormatJSON:
+		writeJSONExample(&buf, root, "", false)
+	case FormatXML:
+		if err := writeXMLExample(&buf, xmlRoot, root, ""); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrNoSelectFormat, format)
+	}
+
+	return []byte(buf.String()), nil
+}
+
+// exampleGen converts a struct into example nodes.
+type exampleGen struct {
+	format string
+	// active contains the struct types that are being converted, so recursive pointers are not followed.
+	active map[reflect.Type]bool
+}
+
+// node converts any value into an example node.
+func (g *exampleGen) node(elem reflect.Value, key string) *exampleNode {
+	node := &exampleNode{key: key}
+
+	for elem.Kind() == reflect.Pointer || elem.Kind() == reflect.Interface {
+		if elem.IsNil() {
+			if elem.Kind() == reflect.Interface {
+				node.value = ""
+				return node
+			}
+
+			elem = g.newValue(elem.Type().Elem())
+		} else {
+			elem = elem.Elem()
+		}
+	}
+
+	typ := elem.Type()
+
+	switch {
+	case typ.Implements(durationType) || typ == timeType || reflect.PointerTo(typ).Implements(textUnmarshalerType):
+		node.value = schemaValue(elem)
+	case typ.Kind() == reflect.Struct:
+		g.active[typ] = true
+		defer delete(g.active, typ)
+
+		node.object = true
+		g.addFields(node, elem)
+	case typ.Kind() == reflect.Map:
+		g.addMap(node, elem)
+	case (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array) && isObject(typ.Elem()):
+		node.list = true
+
+		for idx := 0; idx < elem.Len(); idx++ {
+			node.items = append(node.items, g.node(elem.Index(idx), ""))
+		}
+
+		if len(node.items) == 0 && !g.active[derefType(typ.Elem())] {
+			node.items = append(node.items, g.node(g.newValue(typ.Elem()), ""))
+		}
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		node.value = string(elem.Bytes())
+	default:
+		node.value = schemaValue(elem)
+	}
+
+	return node
+}
+
+// newValue returns a new value with its defaults set, for nil pointers and example entries.
+func (g *exampleGen) newValue(typ reflect.Type) reflect.Value {
+	ptr := reflect.New(typ)
+	_, _ = SetDefaults(ptr.Interface(), nil) // The defaults were already checked with the config.
+
+	return ptr.Elem()
+}
+
+// addFields adds a child node for each member of a struct. Recursive pointers that are nil are skipped.
+func (g *exampleGen) addFields(node *exampleNode, elem reflect.Value) {
+	for _, field := range reflect.VisibleFields(elem.Type()) {
+		if len(field.Index) > 1 {
+			continue
+		}
+
+		tag := parseFieldTag(field, g.format)
+		key, inline, parent := tag.key, tag.inline || tag.remain, node
+
+		if len(tag.path) > 1 {
+			// Nested XML elements: a>b is an element b inside an element a.
+			parent, key = xmlParent(node, tag.path[:len(tag.path)-1]), tag.path[len(tag.path)-1]
+		}
+
+		if tag.skip || (!inline && !field.IsExported()) {
+			continue
+		}
+
+		member := elem.FieldByIndex(field.Index)
+		if member.Kind() == reflect.Pointer && member.IsNil() && g.active[derefType(field.Type)] {
+			continue
+		}
+
+		child := g.node(member, key)
+		if inline {
+			node.children = append(node.children, child.children...)
+			continue
+		}
+
+		child.comment = field.Tag.Get(DescTag)
+		if derefType(field.Type) == secretType {
+			g.secret(child)
+		}
+
+		parent.children = append(parent.children, child)
+	}
+}
+
+// xmlParent returns the element an XML a>b member is written in. Members with the same parents share them.
+func xmlParent(node *exampleNode, path []string) *exampleNode {
+	for _, name := range path {
+		var parent *exampleNode
+
+		for _, child := range node.children {
+			if child.key == name && child.object {
+				parent = child
+			}
+		}
+
+		if parent == nil {
+			parent = &exampleNode{key: name, object: true}
+			node.children = append(node.children, parent)
+		}
+
+		node = parent
+	}
+
+	return node
+}
+
+// secret replaces the value of a Secret with a file reference placeholder.
+func (g *exampleGen) secret(node *exampleNode) {
+	if value, _ := node.value.(string); !strings.HasPrefix(value, DefaultPrefix) {
+		node.value = DefaultPrefix + ExampleSecretPath + node.key
+	}
+
+	if node.comment != "" {
+		node.comment += " "
+	}
+
+	node.comment += "This is a secret; the " + DefaultPrefix + " prefix reads it from a file."
+}
+
+// addMap adds a child node for each map entry, in order. An empty map of structs gets an example entry.
+func (g *exampleGen) addMap(node *exampleNode, elem reflect.Value) {
+	node.object = true
+	keys := elem.MapKeys()
+
+	sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+
+	for _, key := range keys {
+		node.children = append(node.children, g.node(elem.MapIndex(key), fmt.Sprint(key)))
+	}
+
+	if len(keys) == 0 && isObject(elem.Type().Elem()) && !g.active[derefType(elem.Type().Elem())] {
+		node.children = append(node.children, g.node(g.newValue(elem.Type().Elem()), ExampleMapKey))
+	}
+}
+
+// derefType returns the type a pointer points to.
+func derefType(typ reflect.Type) reflect.Type {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	return typ
+}
+
+// isObject returns true if a type is written as an object: a struct (that is not a scalar type) or a map.
+func isObject(typ reflect.Type) bool {
+	typ = derefType(typ)
+
+	switch {
+	case typ.Implements(durationType) || typ == timeType || reflect.PointerTo(typ).Implements(textUnmarshalerType):
+		return false
+	default:
+		return typ.Kind() == reflect.Struct || typ.Kind() == reflect.Map
+	}
+}
+
+// writeComment writes a comment on its own line(s).
+func writeComment(buf *strings.Builder, indent, marker, comment string) {
+	if comment == "" {
+		return
+	}
+
+	for _, line := range strings.Split(comment, "\n") {
+		buf.WriteString(indent + marker + " " + line + "\n")
+	}
+}
+
+// writeTOMLExample writes the scalars in a table, and then its sub-tables and arrays of tables.
+func writeTOMLExample(buf *strings.Builder, node *exampleNode, path []string) {
+	for _, child := range node.children {
+		if !child.object && !child.list {
+			writeComment(buf, "", "#", child.comment)
+			buf.WriteString(tomlKey(child.key) + " = " + tomlValue(child.value) + "\n")
+		}
+	}
+
+	for _, child := range node.children {
+		childPath := append(append([]string{}, path...), tomlKey(child.key))
+
+		switch {
+		case child.object:
+			if hasScalars(child) || child.comment != "" {
+				buf.WriteString("\n")
+				writeComment(buf, "", "#", child.comment)
+				buf.WriteString("[" + strings.Join(childPath, ".") + "]\n")
+			}
+
+			writeTOMLExample(buf, child, childPath)
+		case child.list:
+			for idx, item := range child.items {
+				buf.WriteString("\n")
+
+				if idx == 0 {
+					writeComment(buf, "", "#", child.comment)
+				}
+
+				buf.WriteString("[[" + strings.Join(childPath, ".") + "]]\n")
+				writeTOMLExample(buf, item, childPath)
+			}
+		}
+	}
+}
+
+// hasScalars returns true if a table has values that are not tables, or no values at all.
+// A table that only contains tables does not need a header.
+func hasScalars(node *exampleNode) bool {
+	for _, child := range node.children {
+		if !child.object && !child.list {
+			return true
+		}
+	}
+
+	return len(node.children) == 0
+}
+
+// tomlKey quotes a key if it's not a bare key.
+func tomlKey(key string) string {
+	if tomlBare.MatchString(key) {
+		return key
+	}
+
+	return tomlString(key)
+}
+
+// tomlValue formats a scalar, or a list of scalars, as TOML.
+func tomlValue(value interface{}) string {
+	switch val := value.(type) {
+	case string:
+		return tomlString(val)
+	case []interface{}:
+		items := make([]string, len(val))
+		for idx, item := range val {
+			items[idx] = tomlValue(item)
+		}
+
+		return "[" + strings.Join(items, ", ") + "]"
+	case float32, float64:
+		str := fmt.Sprint(val)
+		if !strings.ContainsAny(str, ".eEnN") {
+			str += ".0" // Make sure it's read back as a float.
+		}
+
+		return str
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// tomlString quotes a basic string. TOML has fewer escapes than Go; other control characters are written as \uXXXX.
+func tomlString(str string) string {
+	var buf strings.Builder
+
+	buf.WriteString(`"`)
+
+	for _, char := range str {
+		switch char {
+		case '"', '\\':
+			buf.WriteString(`\` + string(char))
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\r':
+			buf.WriteString(`\r`)
+		default:
+			if char < 0x20 || char == 0x7f {
+				fmt.Fprintf(&buf, `\u%04X`, char)
+			} else {
+				buf.WriteRune(char)
+			}
+		}
+	}
+
+	buf.WriteString(`"`)
+
+	return buf.String()
+}
+
+// writeYAMLExample writes the members of a mapping at an indentation.
+func writeYAMLExample(buf *strings.Builder, nodes []*exampleNode, indent string) {
+	for _, node := range nodes {
+		writeComment(buf, indent, "#", node.comment)
+		buf.WriteString(indent + yamlScalar(node.key) + ":")
+
+		switch list, _ := node.value.([]interface{}); {
+		case node.object && len(node.children) == 0:
+			buf.WriteString(" {}\n")
+		case node.object:
+			buf.WriteString("\n")
+			writeYAMLExample(buf, node.children, indent+"  ")
+		case node.list && len(node.items) == 0, !node.list && list != nil && len(list) == 0:
+			buf.WriteString(" []\n")
+		case node.list:
+			buf.WriteString("\n")
+
+			for _, item := range node.items {
+				var itemBuf strings.Builder
+
+				writeYAMLExample(&itemBuf, item.children, indent+"    ")
+				// Replace the indentation of the first line with the item marker.
+				buf.WriteString(indent + "  - " + strings.TrimPrefix(itemBuf.String(), indent+"    "))
+			}
+		case list != nil:
+			buf.WriteString("\n")
+
+			for _, item := range list {
+				buf.WriteString(indent + "  - " + yamlScalar(item) + "\n")
+			}
+		default:
+			buf.WriteString(" " + yamlScalar(node.value) + "\n")
+		}
+	}
+}
+
+// yamlScalar formats a scalar as YAML.
+func yamlScalar(value interface{}) string {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return strconv.Quote(fmt.Sprint(value))
+	}
+
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+// writeJSONExample writes an object (or a list) with comments. The comma follows the value, if needed.
+func writeJSONExample(buf *strings.Builder, node *exampleNode, indent string, comma bool) {
+	switch {
+	case node.object:
+		buf.WriteString("{\n")
+
+		for idx, child := range node.children {
+			writeComment(buf, indent+"  ", "//", child.comment)
+			buf.WriteString(indent + "  " + jsonValue(child.key) + ": ")
+			writeJSONExample(buf, child, indent+"  ", idx < len(node.children)-1)
+		}
+
+		buf.WriteString(indent + "}")
+	case node.list:
+		buf.WriteString("[\n")
+
+		for idx, item := range node.items {
+			buf.WriteString(indent + "  ")
+			writeJSONExample(buf, item, indent+"  ", idx < len(node.items)-1)
+		}
+
+		buf.WriteString(indent + "]")
+	default:
+		buf.WriteString(jsonValue(node.value))
+	}
+
+	if comma {
+		buf.WriteString(",")
+	}
+
+	buf.WriteString("\n")
+}
+
+// jsonValue formats a scalar, or a list of scalars, as JSON.
+func jsonValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return strconv.Quote(fmt.Sprint(value))
+	}
+
+	return string(data)
+}
+
+// writeXMLExample writes an element. Lists are written as repeated elements.
+// Returns ErrXMLName if a member or map key cannot be used as an element name.
+func writeXMLExample(buf *strings.Builder, name string, node *exampleNode, indent string) error {
+	if !validXMLName(name) {
+		return fmt.Errorf("%w: %q", ErrXMLName, name)
+	}
+
+	if node.comment != "" {
+		buf.WriteString(indent + "<!-- " + strings.ReplaceAll(node.comment, "--", "- -") + " -->\n")
+	}
+
+	switch list, _ := node.value.([]interface{}); {
+	case node.object:
+		buf.WriteString(indent + "<" + name + ">\n")
+
+		for _, child := range node.children {
+			if err := writeXMLExample(buf, child.key, child, indent+"  "); err != nil {
+				return err
+			}
+		}
+
+		buf.WriteString(indent + "</" + name + ">\n")
+	case node.list:
+		for _, item := range node.items {
+			if err := writeXMLExample(buf, name, item, indent); err != nil {
+				return err
+			}
+		}
+	case list != nil:
+		for _, item := range list {
+			buf.WriteString(indent + "<" + name + ">" + xmlText(item) + "</" + name + ">\n")
+		}
+	default:
+		buf.WriteString(indent + "<" + name + ">" + xmlText(node.value) + "</" + name + ">\n")
+	}
+
+	return nil
+}
+
+// xmlText escapes a scalar for XML.
+func xmlText(value interface{}) string {
+	var buf strings.Builder
+
+	_ = xml.EscapeText(&buf, []byte(fmt.Sprint(value)))
+
+	return buf.String()
+}
@@ -0,0 +1,133 @@
+package cnfgfile_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+type exampleStruct struct {
+	Name     string                   `json:"name" toml:"name" xml:"name" yaml:"name" desc:"Name of this app." default:"app"`
+	Port     int                      `json:"port" toml:"port" xml:"port" yaml:"port" default:"8080"`
+	Ratio    float64                  `json:"ratio" toml:"ratio" xml:"ratio" yaml:"ratio" default:"1"`
+	Debug    bool                     `json:"debug" toml:"debug" xml:"debug" yaml:"debug"`
+	Timeout  cnfgfile.Duration        `json:"timeout" toml:"timeout" xml:"timeout" yaml:"timeout" default:"1m"`
+	Password cnfgfile.Secret          `json:"password" toml:"password" xml:"password" yaml:"password" desc:"DB password."`
+	Tags     []string                 `json:"tags" toml:"tags" xml:"tags" yaml:"tags" default:"a,b"`
+	Server   *exampleServer           `json:"server" toml:"server" xml:"server" yaml:"server" desc:"The web server."`
+	Hosts    []*exampleServer         `json:"hosts" toml:"hosts" xml:"hosts" yaml:"hosts" desc:"Remote hosts."`
+	Named    map[string]exampleServer `json:"named" toml:"named" xml:"-" yaml:"named"`
+}
+
+type exampleServer struct {
+	Listen string          `json:"listen" toml:"listen" xml:"listen" yaml:"listen" default:":80"`
+	Key    cnfgfile.Secret `json:"key" toml:"key" xml:"key" yaml:"key" default:"filepath:/etc/key"`
+}
+
+func TestExample(t *testing.T) {
+	t.Parallel()
+
+	expected := &exampleStruct{
+		Name:     "me",
+		Port:     8080,
+		Ratio:    1,
+		Timeout:  cnfgfile.Duration{Duration: time.Minute},
+		Password: "filepath:/run/secrets/password",
+		Tags:     []string{"a", "b"},
+		Server:   &exampleServer{Listen: ":80", Key: "filepath:/etc/key"},
+		Hosts:    []*exampleServer{{Listen: ":80", Key: "filepath:/etc/key"}},
+		Named:    map[string]exampleServer{"example": {Listen: ":80", Key: "filepath:/etc/key"}},
+	}
+
+	for _, format := range []string{cnfgfile.FormatJSON, cnfgfile.FormatYAML, cnfgfile.FormatTOML, cnfgfile.FormatXML} {
+		config := &exampleStruct{Name: "me", Password: "secret value"}
+		example, err := cnfgfile.Example(config, format)
+		require.NoError(t, err, format)
+		assert.Equal(t, &exampleStruct{Name: "me", Password: "secret value"}, config, "the input must not change")
+		assert.NotContains(t, string(example), "secret value", "secrets must never be written")
+		assert.Contains(t, string(example), "Name of this app.", format)
+		assert.Contains(t, string(example), "DB password. This is a secret", format)
+
+		if format == cnfgfile.FormatJSON {
+			example = regexp.MustCompile(`(?m)^\s*//.*\n`).ReplaceAll(example, nil)
+		}
+
+		output := &exampleStruct{}
+		require.NoError(t, cnfgfile.Unmarshal(output, writeFile(t, "example."+format, example)), string(example))
+
+		want := *expected
+		if format == cnfgfile.FormatXML {
+			want.Named = nil
+		}
+
+		assert.Equal(t, &want, output, string(example))
+	}
+}
+
+func TestExampleFormats(t *testing.T) {
+	t.Parallel()
+
+	example, err := cnfgfile.Example(exampleServer{Listen: "x"}, cnfgfile.FormatTOML)
+	require.NoError(t, err)
+	assert.Equal(t, "listen = \"x\"\n# This is a secret; the filepath: prefix reads it from a file.\n"+
+		"key = \"filepath:/etc/key\"\n", string(example))
+
+	example, err = cnfgfile.Example(&exampleStruct{}, cnfgfile.FormatYAML)
+	require.NoError(t, err)
+	assert.Contains(t, string(example), "# Remote hosts.\nhosts:\n  - listen: :80\n    # This is a secret")
+
+	example, err = cnfgfile.Example(&exampleStruct{}, cnfgfile.FormatJSON)
+	require.NoError(t, err)
+	assert.Contains(t, string(example), "  // The web server.\n  \"server\": {\n    \"listen\": \":80\",\n")
+
+	example, err = cnfgfile.Example(&exampleStruct{}, cnfgfile.FormatXML)
+	require.NoError(t, err)
+	assert.Contains(t, string(example), "<config>\n  <!-- Name of this app. -->\n  <name>app</name>\n")
+
+	_, err = cnfgfile.Example(&exampleStruct{}, "ini")
+	require.ErrorIs(t, err, cnfgfile.ErrNoSelectFormat)
+
+	_, err = cnfgfile.Example([]string{}, cnfgfile.FormatTOML)
+	require.ErrorIs(t, err, cnfgfile.ErrNotStruct)
+}
+
+func TestExampleEscaping(t *testing.T) {
+	t.Parallel()
+
+	type tomlConfig struct {
+		Text string            `toml:"text"`
+		Map  map[string]string `toml:"map"`
+	}
+
+	config := &tomlConfig{Text: "bell\a null\x00 del\x7f \"quoted\" \\ tab\t é", Map: map[string]string{"key\x01": "v"}}
+	example, err := cnfgfile.Example(config, cnfgfile.FormatTOML)
+	require.NoError(t, err)
+	assert.Contains(t, string(example), `"bell\u0007 null\u0000 del\u007F \"quoted\" \\ tab\t é"`)
+
+	output := &tomlConfig{}
+	require.NoError(t, cnfgfile.Unmarshal(output, writeFile(t, "example.toml", example)), string(example))
+	assert.Equal(t, config, output, "toml strings must be read back as they were written")
+
+	type xmlConfig struct {
+		Host string `xml:"db>host"`
+		Port int    `xml:"db>port"`
+	}
+
+	example, err = cnfgfile.Example(&xmlConfig{Host: "localhost", Port: 5432}, cnfgfile.FormatXML)
+	require.NoError(t, err)
+	assert.Equal(t, "<config>\n  <db>\n    <host>localhost</host>\n    <port>5432</port>\n  </db>\n</config>\n",
+		string(example), "a>b tags must be written as nested elements")
+
+	xmlOutput := &xmlConfig{}
+	require.NoError(t, cnfgfile.Unmarshal(xmlOutput, writeFile(t, "example.xml", example)), string(example))
+	assert.Equal(t, &xmlConfig{Host: "localhost", Port: 5432}, xmlOutput)
+
+	_, err = cnfgfile.Example(&struct {
+		Map map[string]string `xml:"map"`
+	}{Map: map[string]string{"bad key": "x"}}, cnfgfile.FormatXML)
+	require.ErrorIs(t, err, cnfgfile.ErrXMLName)
+}
@@ -0,0 +1,88 @@
+package cnfgfile
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Characters used to provide alternatives in a reference.
+const (
+	alternativeSep = "|"
+	optionalSuffix = "?"
+)
+
+// resolveReference tries each alternative in a reference until one can be read.
+// Returns the source that was used, and its content. See eachAlternative.
+func (p *parser) resolveReference(reference, encoding string) (string, string, error) {
+	var content string
+
+	source, literal, err := p.eachAlternative(reference, encoding, func(path, encoding string) (err error) {
+		content, err = p.readReference(path, encoding)
+		return err
+	})
+	if source == "" {
+		return "", literal, err
+	}
+
+	return source, content, err
+}
+
+// eachAlternative calls a function with the path and encoding of each alternative in a reference,
+// until the function does not return a missing file error. Parse and Check both use this, so they
+// always agree on which source is used. Returns the source that was used, and a literal fallback value.
+// The source is empty if a literal fallback was used, or if an optional file was missing. If every file
+// is missing the error from the last file is returned, along with its source.
+// The encoding applies to the first alternative, the others may have their own.
+// A reference (or alternative) that is the path to an existing file is used as-is,
+// so existing file names may contain a | or end with a ?.
+func (p *parser) eachAlternative(
+	reference, encoding string, try func(path, encoding string) error,
+) (string, string, error) {
+	alternatives := strings.Split(reference, alternativeSep)
+	if p.exists(reference) || (len(alternatives) == 1 && !strings.HasSuffix(reference, optionalSuffix)) {
+		return reference, "", try(reference, encoding)
+	}
+
+	var err error
+
+	for idx, alternative := range alternatives {
+		source := strings.TrimSpace(alternative)
+
+		if idx > 0 {
+			var ok bool
+			if source, encoding, ok = p.cutPrefix(source); !ok {
+				return "", strings.TrimSpace(alternative), nil // Literal fallback value.
+			}
+		}
+
+		path, optional := strings.CutSuffix(strings.TrimSpace(source), optionalSuffix)
+		if optional && p.exists(source) {
+			path, optional = source, false
+		}
+
+		if err = try(path, encoding); err == nil {
+			return path, "", nil
+		} else if !isMissing(err) {
+			return path, "", err
+		} else if optional {
+			return "", "", nil
+		}
+
+		reference = path
+	}
+
+	return reference, "", err
+}
+
+// exists returns true if a reference is the path to an existing file (or directory).
+func (p *parser) exists(reference string) bool {
+	_, err := os.Stat(p.TransformPath(reference))
+	return err == nil
+}
+
+// isMissing returns true if an error means the file (or the selected value in the file) does not exist.
+func isMissing(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, ErrSelectorNotFound)
+}
@@ -0,0 +1,115 @@
+package cnfgfile_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+func TestParseFallback(t *testing.T) {
+	t.Parallel()
+
+	file := makeTextFile(t)
+	defer os.Remove(file)
+
+	const prefix = cnfgfile.DefaultPrefix
+
+	data := &struct {
+		Optional string
+		Found    string
+		Second   string
+		Default  string
+		Selector string
+		Empty    string
+	}{
+		Optional: prefix + "/no_file?",
+		Found:    prefix + file + "?",
+		Second:   prefix + "/no_file|" + prefix + file + "|default",
+		Default:  prefix + "/no_file | " + prefix + "/no_file2 | default value",
+		Selector: prefix + file + ".json#/nope|" + prefix + file,
+		Empty:    prefix + "/no_file|" + prefix + "/no_file2?|default",
+	}
+
+	output, err := cnfgfile.Parse(data, &cnfgfile.Opts{TransformFile: func(s string) string { return s + "!" }})
+	require.NoError(t, err)
+	assert.Empty(t, data.Optional, "a missing optional file must leave the value empty")
+	assert.Equal(t, "hi, this is a string!", data.Found)
+	assert.Equal(t, "hi, this is a string!", data.Second)
+	assert.Equal(t, "default value", data.Default, "literal values must not be transformed")
+	assert.Equal(t, "hi, this is a string!", data.Selector)
+	assert.Empty(t, data.Empty, "an optional file stops the search")
+
+	assert.Equal(t, map[string]string{
+		"Config.Optional": "",
+		"Config.Found":    file,
+		"Config.Second":   file,
+		"Config.Default":  "",
+		"Config.Selector": file,
+		"Config.Empty":    "",
+	}, output, "the output map must contain the source that was used")
+}
+
+func TestParseFallbackErrors(t *testing.T) {
+	t.Parallel()
+
+	data := &struct{ Name string }{Name: cnfgfile.DefaultPrefix + "/no_file|" + cnfgfile.DefaultPrefix + "/no_file2"}
+
+	output, err := cnfgfile.Parse(data, nil)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.ErrorContains(t, err, "element failure: Config.Name: opening file: open /no_file2:")
+	assert.Equal(t, "/no_file2", output["Config.Name"], "the last file tried must be in the output map")
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.json"), []byte("{"), 0o600))
+
+	data.Name = cnfgfile.DefaultPrefix + filepath.Join(dir, "bad.json#/key") + "|default"
+	_, err = cnfgfile.Parse(data, nil)
+	require.ErrorContains(t, err, "unmarshaling file", "errors other than missing files must be returned")
+}
+
+func TestParseFallbackLiteralPath(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows file names may not contain | or ?")
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"a|b", "token?"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600))
+	}
+
+	data := &struct {
+		Pipe     string
+		Question string
+		Second   string
+	}{
+		Pipe:     cnfgfile.DefaultPrefix + filepath.Join(dir, "a|b"),
+		Question: cnfgfile.DefaultPrefix + filepath.Join(dir, "token?"),
+		Second:   cnfgfile.DefaultPrefix + "/no_file|" + cnfgfile.DefaultPrefix + filepath.Join(dir, "token?"),
+	}
+
+	output, err := cnfgfile.Parse(data, nil)
+	require.NoError(t, err, "existing file names must not be split or made optional")
+	assert.Equal(t, "a|b", data.Pipe)
+	assert.Equal(t, "token?", data.Question)
+	assert.Equal(t, "token?", data.Second)
+	assert.Equal(t, filepath.Join(dir, "token?"), output["Config.Question"])
+
+	results, err := cnfgfile.Check(&struct{ Pipe, Question string }{
+		Pipe:     cnfgfile.DefaultPrefix + filepath.Join(dir, "a|b"),
+		Question: cnfgfile.DefaultPrefix + filepath.Join(dir, "token?"),
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	for _, result := range results {
+		assert.True(t, result.Exists, result.Element)
+		assert.False(t, result.Fallback, result.Element)
+	}
+}
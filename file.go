@@ -10,16 +10,25 @@
 package cnfgfile
 
 import (
+	"bufio"
+	"bytes"
 	"compress/bzip2"
 	"compress/gzip"
+	"crypto/ecdh"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"time"
 
 	toml "github.com/BurntSushi/toml"
 	yaml "gopkg.in/yaml.v3"
@@ -27,73 +36,427 @@ import (
 
 // Errors this library may produce.
 var (
-	ErrPanic  = errors.New("bug in the golift.io/cnfgfile package; caught panic")
-	ErrNoFile = errors.New("must provide at least 1 file to unmarshal")
-	ErrNotPtr = errors.New("ReadConfigs: must provide a pointer to data structure that can be modified")
+	ErrPanic      = errors.New("bug in the golift.io/cnfgfile package; caught panic")
+	ErrNoFile     = errors.New("must provide at least 1 file to unmarshal")
+	ErrNotPtr     = errors.New("ReadConfigs: must provide a pointer to data structure that can be modified")
+	ErrHTTPStatus = errors.New("unexpected http response status")
+	ErrHTTPSize   = errors.New("http response body is larger than HTTPMaxSize")
+	ErrNoFiles    = errors.New("pattern did not match any config files")
 )
 
+// UnmarshalOpts defaults.
+const (
+	// DefaultHTTPTimeout is used when UnmarshalOpts.HTTPTimeout is not set.
+	DefaultHTTPTimeout = 30 * time.Second
+	// DefaultHTTPMaxSize is used when UnmarshalOpts.HTTPMaxSize is not set.
+	DefaultHTTPMaxSize = uint(10 * MiB)
+)
+
+// OptionalPrefix marks a config file (or URL) as optional when it's prefixed to the location,
+// ie. optional:local.yaml. Missing optional files (and patterns without matches) are skipped.
+// Other errors, like permission or parse errors, are still returned. The prefix is removed before
+// the rest of the location is checked for a glob pattern, and it cannot be mistaken for one.
+const OptionalPrefix = "optional:"
+
+// Supported config file formats.
+const (
+	FormatJSON = "json"
+	FormatXML  = "xml"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// Compression formats detected by deCompress.
+const (
+	compressionGzip  = "gzip"
+	compressionBzip2 = "bzip2"
+)
+
+// UnmarshalOpts contains the optional input parameters for UnmarshalWith().
+type UnmarshalOpts struct {
+	// HTTPClient is used to fetch http:// and https:// config locations.
+	// If left nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// HTTPTimeout limits how long each http request may take.
+	// If left at 0, the default of 30 seconds is used.
+	HTTPTimeout time.Duration
+	// HTTPMaxSize is the maximum amount of bytes read from an http response body. A larger body returns
+	// ErrHTTPSize, so a large (or hostile) server cannot use all your memory. If left at 0, 10MiB is used.
+	HTTPMaxSize uint
+	// HTTPCache enables conditional requests using the ETag and Last-Modified headers.
+	// When the server responds 304 Not Modified, the cached body is unmarshaled instead.
+	// Re-use the same cache (and UnmarshalOpts) between calls. Leave nil to disable caching.
+	HTTPCache *HTTPCache
+	// DecryptKeys are symmetric 32 byte keys used to decrypt encrypted config files. See EncryptConfig.
+	DecryptKeys [][]byte
+	// DecryptIdentities are X25519 private keys used to decrypt encrypted config files. See EncryptConfig.
+	DecryptIdentities []*ecdh.PrivateKey
+	// Logger receives an event for every config file (or URL) that is opened. The events include the
+	// format, compression, size in bytes and how long it took. Leave nil to disable logging.
+	Logger *slog.Logger
+	// KeyMatch makes keys match struct members the same way in every format, ie. KeyMatchFold ignores case.
+	// Without it, each format's package matches keys its own way. Keys are read from the format's struct tags,
+	// or the cnfg tag, see CnfgTag.
+	KeyMatch KeyMatch
+}
+
 // Unmarshal parses a configuration file (of any format) into a config struct.
 // This is a shorthand method for calling Unmarshal against the json, xml, yaml
 // or toml packages. If the file name contains an appropriate suffix it is
 // unmarshaled with the corresponding package. If the suffix is missing, TOML
 // is assumed. Works with multiple files, so you can have stacked configurations.
 // Will detect (and decompress) a file that is gzip or bzip2 compressed.
+// Locations that begin with http:// or https:// are downloaded, and directories
+// and glob patterns are expanded into the files they contain, see UnmarshalWith.
+// Encrypted config files (see EncryptConfig) are decrypted with UnmarshalOpts keys.
+// A config struct with cnfg tags is unmarshaled the same way for every format, see CnfgTag.
 func Unmarshal(config interface{}, configFile ...string) error {
+	_, err := UnmarshalWith(config, nil, configFile...)
+	return err
+}
+
+// UnmarshalWith works just like Unmarshal, but accepts options. opts may be nil, uses defaults.
+// The format of a URL is chosen from the Content-Type response header. If that is missing
+// or generic (like text/plain), the URL path suffix is used, just like a file name.
+// A directory, or a glob pattern like /etc/app/conf.d/*.toml, is expanded into the files it
+// contains (or matches) in lexical order. Each file's format is chosen by its own name.
+// Sub directories, hidden files and editor or package manager backups are skipped.
+// A location that exists is never treated as a pattern, so app[prod].toml may be a file name.
+// A directory without any files is not an error. A pattern without any files returns ErrNoFiles.
+// Prefix a location with optional: (OptionalPrefix) to skip it if it does not exist,
+// ie. optional:/etc/app/local.yaml. A URL that responds 404 Not Found is also considered missing.
+// Returns the list of files and URLs that were unmarshaled, in the order they were unmarshaled.
+// Check this list to find out which optional files were actually loaded.
+func UnmarshalWith(config interface{}, opts *UnmarshalOpts, configFile ...string) ([]string, error) {
 	if len(configFile) == 0 {
-		return ErrNoFile
+		return nil, ErrNoFile
 	}
 
-	for _, fileName := range configFile {
+	unmarshaler := opts.newUnmarshaler()
+
+	return unmarshaler.each(configFile, func(fileName string) error {
+		return unmarshaler.unmarshal(config, fileName)
+	})
+}
+
+// each expands every config location, and calls a function with each file name (or URL).
+// Missing optional files are skipped. Returns the list of files the function succeeded for.
+func (u *unmarshaler) each(configFile []string, unmarshal func(string) error) ([]string, error) {
+	loaded := []string{}
+
+	for _, location := range configFile {
+		location, optional := strings.CutPrefix(location, OptionalPrefix)
+
+		fileNames, err := expandLocation(location)
+		if optional && errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return loaded, err
+		}
+
+		for _, fileName := range fileNames {
+			err := unmarshal(fileName)
+			if optional && errors.Is(err, fs.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return loaded, err
+			}
+
+			loaded = append(loaded, fileName)
+		}
+	}
+
+	return loaded, nil
+}
+
+// UnmarshalDir unmarshals every config file in a directory, in lexical order.
+// This is useful for drop-in config directories, like /etc/app/conf.d.
+// Call Unmarshal (or UnmarshalWith) with the main config file and the directory
+// to load both in one call. See UnmarshalWith for the files that are skipped.
+// Returns the list of files that were unmarshaled.
+func UnmarshalDir(config interface{}, dirPath string) ([]string, error) {
+	return UnmarshalWith(config, nil, dirPath)
+}
+
+// unmarshaler is used for internal methods.
+type unmarshaler struct {
+	UnmarshalOpts
+	// bound collects the elements each file sets. The Loader sets this to find the provenance of each element.
+	bound map[string]bool
+}
+
+// newUnmarshaler returns an unmarshaler with attached UnmarshalOpts. Sets defaults for any omitted values.
+func (input *UnmarshalOpts) newUnmarshaler() *unmarshaler {
+	output := &unmarshaler{
+		UnmarshalOpts: UnmarshalOpts{
+			HTTPClient:  http.DefaultClient,
+			HTTPTimeout: DefaultHTTPTimeout,
+			HTTPMaxSize: DefaultHTTPMaxSize,
+			HTTPCache:   nil,
+		},
+	}
+
+	if input == nil {
+		return output
+	}
+
+	output.HTTPClient = pick(input.HTTPClient, output.HTTPClient)
+	output.HTTPTimeout = pick(input.HTTPTimeout, output.HTTPTimeout)
+	output.HTTPMaxSize = pick(input.HTTPMaxSize, output.HTTPMaxSize)
+	output.HTTPCache = input.HTTPCache
+	output.DecryptKeys = input.DecryptKeys
+	output.DecryptIdentities = input.DecryptIdentities
+	output.Logger = input.Logger
+	output.KeyMatch = input.KeyMatch
+
+	return output
+}
+
+// unmarshal opens a single file or URL, and decodes it into the config.
+// A config with a cnfg tag (or a KeyMatch, or loaded by a Loader) is decoded into a tree, and the tree is bound to the config.
+func (u *unmarshaler) unmarshal(config interface{}, fileName string) error {
+	if u.bound == nil && u.KeyMatch == KeyMatchDefault && !usesCnfgTag(reflect.TypeOf(config), map[reflect.Type]bool{}) {
+		return u.load(fileName, func(reader io.Reader, format string) error {
+			return decode(config, reader, fileName, format)
+		})
+	}
+
+	if reflect.TypeOf(config).Kind() != reflect.Pointer {
+		return ErrNotPtr
+	}
+
+	return u.load(fileName, func(reader io.Reader, format string) error {
+		tree, err := decodeStrict(reader, fileName, format)
+		if err != nil {
+			return err
+		}
+
+		binder := &binder{
+			format: format,
+			match:  u.KeyMatch,
+			bound:  u.bound,
+		}
+		if err := binder.bind(reflect.ValueOf(config), tree, DefaultName); err != nil {
+			return fmt.Errorf("unmarshaling file %s: %w", fileName, err)
+		}
+
+		return nil
+	})
+}
+
+// load opens a single file or URL, decompresses (and decrypts) it, and passes it to a decode function.
+// An event is logged for every file (or URL) that is opened.
+func (u *unmarshaler) load(fileName string, decodeFn func(io.Reader, string) error) error {
+	start := time.Now()
+	source := &countingReader{}
+	format := FormatOf(fileName)
+
+	if isURL(fileName) {
+		body, urlFormat, err := u.fetch(fileName)
+		if err != nil {
+			return fmt.Errorf("fetching url %s: %w", fileName, err)
+		}
+
+		source.Reader, format = bytes.NewReader(body), urlFormat
+	} else {
 		fileOpen, err := os.Open(fileName)
 		if err != nil {
 			return fmt.Errorf("opening file %s: %w", fileName, err)
 		}
 		defer fileOpen.Close()
 
-		fileReader, err := deCompress(fileOpen)
+		source.Reader = fileOpen
+	}
 
-		switch lowerName := strings.ToLower(fileName); {
-		case err != nil:
-			return err
-		case strings.Contains(lowerName, ".json"):
-			err = json.NewDecoder(fileReader).Decode(config)
-		case strings.Contains(lowerName, ".xml"):
-			err = xml.NewDecoder(fileReader).Decode(config)
-		case strings.Contains(lowerName, ".yaml"), strings.Contains(lowerName, ".yml"):
-			err = yaml.NewDecoder(fileReader).Decode(config)
-		default:
-			_, err = toml.NewDecoder(fileReader).Decode(config)
+	compression, encrypted, err := u.decode(source, fileName, format, decodeFn)
+
+	msg := "loaded config file"
+	if err != nil {
+		msg = "failed loading config file"
+	}
+
+	logEvent(u.Logger, msg, err,
+		slog.String("file", fileName),
+		slog.String("format", format),
+		slog.String("compression", compression),
+		slog.Bool("encrypted", encrypted),
+		slog.Int64("bytes", source.count),
+		slog.Duration("elapsed", time.Since(start)),
+	)
+
+	return err
+}
+
+// decode unmarshals an uncompressed reader into the config using the provided format.
+func decode(config interface{}, reader io.Reader, fileName, format string) error {
+	var err error
+
+	switch format {
+	case FormatJSON:
+		err = json.NewDecoder(reader).Decode(config)
+	case FormatXML:
+		err = xml.NewDecoder(reader).Decode(config)
+	case FormatYAML:
+		err = yaml.NewDecoder(reader).Decode(config)
+	default:
+		_, err = toml.NewDecoder(reader).Decode(config)
+	}
+
+	if err != nil {
+		return fmt.Errorf("unmarshaling file %s: %w", fileName, err)
+	}
+
+	return nil
+}
+
+// expandLocation turns a directory or glob pattern into a sorted list of files.
+// URLs and plain file names are returned as-is. A location that exists is never a pattern.
+// A pattern that does not match any files returns ErrNoFiles (and fs.ErrNotExist).
+func expandLocation(location string) ([]string, error) {
+	if isURL(location) {
+		return []string{location}, nil
+	}
+
+	var fileNames []string
+
+	info, err := os.Stat(location)
+
+	switch {
+	case err == nil && info.IsDir():
+		if fileNames, err = listDir(location); err != nil {
+			return nil, err
 		}
+	case err == nil || !strings.ContainsAny(location, "*?["):
+		return []string{location}, nil // Let unmarshal() return any error opening this file.
+	default:
+		if fileNames, err = filepath.Glob(location); err != nil {
+			return nil, fmt.Errorf("expanding pattern %s: %w", location, err)
+		}
+	}
 
-		if err != nil {
-			return fmt.Errorf("unmarshaling file %s: %w", fileName, err)
+	output := []string{}
+
+	for _, fileName := range fileNames {
+		if info, err := os.Stat(fileName); err == nil && !info.IsDir() && !skipFile(filepath.Base(fileName)) {
+			output = append(output, fileName)
 		}
 	}
 
-	return nil
+	sort.Strings(output)
+
+	if len(output) == 0 && (info == nil || !info.IsDir()) {
+		return nil, fmt.Errorf("%w: %s (%w)", ErrNoFiles, location, fs.ErrNotExist)
+	}
+
+	return output, nil
 }
 
-func deCompress(fileReader *os.File) (io.Reader, error) {
-	buff := make([]byte, 512) //nolint:mnd
-	if _, err := fileReader.Read(buff); err != nil {
-		return nil, fmt.Errorf("reading file %s: %w", fileReader.Name(), err)
+// listDir returns the paths of all the entries in a directory.
+func listDir(dirPath string) ([]string, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading directory %s: %w", dirPath, err)
 	}
 
-	if _, err := fileReader.Seek(0, io.SeekStart); err != nil {
-		return nil, fmt.Errorf("seeking file start %s: %w", fileReader.Name(), err)
+	fileNames := make([]string, len(entries))
+	for idx, entry := range entries {
+		fileNames[idx] = filepath.Join(dirPath, entry.Name())
+	}
+
+	return fileNames, nil
+}
+
+// skipFile returns true for hidden files, and backup files left by editors and package managers.
+func skipFile(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") ||
+		(strings.HasPrefix(name, "#") && strings.HasSuffix(name, "#")) {
+		return true
+	}
+
+	for _, suffix := range []string{
+		".bak", ".swp", ".swo", ".tmp", ".orig", ".rej", ".rpmnew", ".rpmsave", ".rpmorig",
+		".dpkg-old", ".dpkg-new", ".dpkg-dist", ".dpkg-bak", ".dpkg-tmp", ".ucf-old", ".ucf-new", ".ucf-dist",
+	} {
+		if strings.HasSuffix(strings.ToLower(name), suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decodeTree decodes a reader into a generic tree of maps, slices and values using the provided format.
+// The XML format is not supported.
+func decodeTree(reader io.Reader, fileName, format string) (interface{}, error) {
+	switch format {
+	case FormatXML:
+		return nil, fmt.Errorf("%w: %s", ErrNoSelectFormat, format)
+	case FormatTOML:
+		tree := map[string]interface{}{}
+		err := decode(&tree, reader, fileName, format)
+
+		return tree, err
+	default:
+		var tree interface{}
+		err := decode(&tree, reader, fileName, format)
+
+		return tree, err
+	}
+}
+
+// FormatOf returns the format of a file based on its name. TOML is the default.
+func FormatOf(fileName string) string {
+	switch lowerName := strings.ToLower(fileName); {
+	case strings.Contains(lowerName, ".json"):
+		return FormatJSON
+	case strings.Contains(lowerName, ".xml"):
+		return FormatXML
+	case strings.Contains(lowerName, ".yaml"), strings.Contains(lowerName, ".yml"):
+		return FormatYAML
+	default:
+		return FormatTOML
+	}
+}
+
+// deCompressByName decompresses a gzip (.gz) or bzip2 (.bz2) file, based on its name. Other files are
+// returned as-is. Parse uses this, because a plain secret may begin with the same bytes as a compressed file.
+func deCompressByName(reader io.Reader, fileName string) (io.Reader, string, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".gz", ".gzip":
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, "", fmt.Errorf("decompressing gzip file: %w", err)
+		}
+
+		return gz, compressionGzip, nil
+	case ".bz2", ".bzip2":
+		return bzip2.NewReader(reader), compressionBzip2, nil
+	default:
+		return reader, "", nil
+	}
+}
+
+// deCompress detects gzip and bzip2 compressed data, and returns a reader that decompresses it.
+// Also returns the compression that was detected, or an empty string if the data is not compressed.
+func deCompress(reader io.Reader, fileName string) (io.Reader, string, error) {
+	fileReader := bufio.NewReader(reader)
+
+	buff, err := fileReader.Peek(512) //nolint:mnd
+	if len(buff) == 0 {
+		return nil, "", fmt.Errorf("reading file %s: %w", fileName, err)
 	}
 
 	switch {
 	case http.DetectContentType(buff) == "application/x-gzip":
 		gz, err := gzip.NewReader(fileReader)
 		if err != nil {
-			return nil, fmt.Errorf("file detected as gz, decompress failed: %w", err)
+			return nil, "", fmt.Errorf("file detected as gz, decompress failed: %w", err)
 		}
 
-		return gz, nil
+		return gz, compressionGzip, nil
 	case strings.HasPrefix(string(buff), "\x42\x5a\x68"):
-		return bzip2.NewReader(fileReader), nil
+		return bzip2.NewReader(fileReader), compressionBzip2, nil
 	default:
-		return fileReader, nil
+		return fileReader, "", nil
 	}
 }
@@ -3,6 +3,7 @@ package cnfgfile_test
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -191,3 +192,78 @@ func ExampleUnmarshal() {
 	fmt.Printf("interval: %v, location: %v, provided: %v", config.Interval, config.Location, config.Provided)
 	// Output: interval: 5m, location: Earth, provided: true
 }
+
+func TestUnmarshalDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"10-base.toml":       "[struct]\nint = 1\nbool = true\n",
+		"20-override.yaml":   "struct:\n  int: 2\n",
+		"30-last.json":       `{"struct": {"string": "json"}}`,
+		".40-hidden.json":    `{"struct": {"int": 40}}`,
+		"50-backup.toml~":    "[struct]\nint = 50\n",
+		"60-package.rpmnew":  "[struct]\nint = 60\n",
+		"#70-autosave.toml#": "[struct]\nint = 70\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600))
+	}
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "80-sub.toml"), 0o700))
+
+	config := &testStruct{}
+	loaded, err := cnfgfile.UnmarshalDir(config, dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "10-base.toml"),
+		filepath.Join(dir, "20-override.yaml"),
+		filepath.Join(dir, "30-last.json"),
+	}, loaded, "files must be loaded in lexical order, and skipped files must not be loaded")
+	assert.EqualValues(t, 2, config.Struct.Int, "later files must override earlier files")
+	assert.True(t, config.Struct.Bool, "values not in later files must remain")
+	require.NotNil(t, config.Struct.StringP)
+	assert.Equal(t, "json", *config.Struct.StringP)
+
+	config = &testStruct{}
+	loaded, err = cnfgfile.UnmarshalWith(config, nil, "tests/config.toml", filepath.Join(dir, "*.toml"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tests/config.toml", filepath.Join(dir, "10-base.toml")}, loaded)
+	assert.EqualValues(t, 1, config.Struct.Int)
+
+	loaded, err = cnfgfile.UnmarshalWith(config, nil, t.TempDir(), cnfgfile.OptionalPrefix+filepath.Join(dir, "*.nothing"))
+	require.NoError(t, err, "empty directories and optional patterns are not errors")
+	assert.Empty(t, loaded)
+
+	_, err = cnfgfile.UnmarshalWith(config, nil, filepath.Join(dir, "*.nothing"))
+	require.ErrorIs(t, err, cnfgfile.ErrNoFiles, "a required pattern must match a file")
+
+	literal := filepath.Join(dir, "app[prod].toml")
+	require.NoError(t, os.WriteFile(literal, []byte("[struct]\nint = 9\n"), 0o600))
+	loaded, err = cnfgfile.UnmarshalWith(config, nil, literal)
+	require.NoError(t, err)
+	assert.Equal(t, []string{literal}, loaded, "a file that exists must not be treated as a pattern")
+	assert.EqualValues(t, 9, config.Struct.Int)
+
+	_, err = cnfgfile.UnmarshalWith(config, nil, "[")
+	require.ErrorIs(t, err, filepath.ErrBadPattern)
+}
+
+func TestUnmarshalOptional(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.yaml"), []byte("struct: [\n"), 0o600))
+
+	config := &testStruct{}
+	loaded, err := cnfgfile.UnmarshalWith(config, nil,
+		"tests/config.toml", cnfgfile.OptionalPrefix+filepath.Join(dir, "local.yaml"), cnfgfile.OptionalPrefix+"tests/config.json")
+	testUnmarshalValues(t, assert.New(t), config, err, "TestUnmarshalOptional")
+	assert.Equal(t, []string{"tests/config.toml", "tests/config.json"}, loaded,
+		"missing optional files must not be in the loaded list")
+
+	_, err = cnfgfile.UnmarshalWith(config, nil, cnfgfile.OptionalPrefix+filepath.Join(dir, "bad.yaml"))
+	require.ErrorContains(t, err, "unmarshaling file", "parse errors in optional files must be returned")
+
+	_, err = cnfgfile.UnmarshalWith(config, nil, filepath.Join(dir, "local.yaml"))
+	require.ErrorIs(t, err, os.ErrNotExist, "files without the optional prefix must exist")
+}
@@ -5,10 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
 	"os"
 	"reflect"
 	"runtime/debug"
 	"strings"
+	"time"
 )
 
 // Opts contains the optional input parameters for Parse() to control how a data structure is processed.
@@ -26,7 +29,12 @@ type Opts struct {
 	NoTrim bool
 	// MaxSize is the maximum amount of bytes that are read in from an external config file.
 	// If you don't expect large values, leave this small. If left at 0, the default of 1024 is used.
+	// Use a ByteSize in your own config file to expose it, ie. max_size = "4KiB", and convert it with uint().
 	MaxSize uint
+	// SelectMaxSize is the maximum amount of bytes that are read from a file with a selector, ie.
+	// filepath:/run/secrets/db.json#/password. The whole file must be decoded to select a value, so MaxSize
+	// does not apply to it. A larger file returns ErrSelectSize. If left at 0, the default of 1MiB is used.
+	SelectMaxSize uint
 	// MaxDepth controls how deep into nested structs, maps, slices and pointers that Parse will recurse.
 	// If left unchecked, recursive pointers may use all your memory and crash, so a maximum is required.
 	// If left at 0, the default of 200 is set.
@@ -39,14 +47,33 @@ type Opts struct {
 	// TransformPath allows you to pass a custom function to wrap the file content. Can be used,
 	// for instance if you need to remove all new lines from the file's content.
 	TransformFile func(string) string
+	// Cache stores the content of every file read. Each file is only read once per cache, so every
+	// element that references the same file gets identical content. If left nil, a new cache is
+	// used for each Parse() call. Provide your own to share it between calls, and invalidate it
+	// with its Forget() and Clear() methods when your files change.
+	Cache *FileCache
+	// DecryptKey is the 32 byte key used to decrypt encrypted values, ie. enc:AES256GCM:<base64>.
+	// Create encrypted values with Encrypt(). Values are only decrypted if they begin with enc:<cipher>: and
+	// a known cipher; other values, ie. enc:foo, are left alone. Parse returns ErrNoDecryptKey if it finds an
+	// encrypted value, and neither this nor DecryptKeyFile is set. Only the AES256GCM cipher is supported.
+	DecryptKey []byte
+	// DecryptKeyFile is read for the DecryptKey if DecryptKey is empty. The file may contain a raw, hex or
+	// base64 encoded key. It's only read if an encrypted value is found.
+	DecryptKeyFile string
+	// Logger receives an event for every file reference that is resolved. The events include the element name,
+	// the path (after TransformPath), the size, and whether the content was truncated to MaxSize.
+	// A file that cannot be read is logged as a warning with the error. The content of the file is never
+	// logged. Leave nil to disable logging.
+	Logger *slog.Logger
 }
 
 // Parse(Opts) Defaults.
 const (
-	DefaultPrefix   = "filepath:"
-	DefaultMaxSize  = uint(1024)
-	DefaultName     = "Config"
-	DefaultMaxDepth = uint(200)
+	DefaultPrefix        = "filepath:"
+	DefaultMaxSize       = uint(1024)
+	DefaultSelectMaxSize = uint(MiB)
+	DefaultName          = "Config"
+	DefaultMaxDepth      = uint(200)
 )
 
 // ElemError is returned as an error interface when there's an error reading a string-parsed file.
@@ -88,6 +115,18 @@ func (p *ElemError) Unwrap() error {
 // The output map is a map of Config.Item => filepath. Use this to see what files were read-in for each config path.
 // If there is an element failure, the failed element and all prior parsed elements will be present in the map.
 // Unwrap errors into a ElemError type to get the failed file name and a derived name of the element it was found in.
+// A reference to a directory, found in a map with string keys and values or in a slice of strings, is
+// replaced with the contents of each file in the directory; the map keys are the file names. Hidden files
+// (and directories) are skipped, so the ..data symlink layout of Kubernetes secret volumes works.
+// A reference may end with a selector to read a single value from a JSON, YAML, TOML or dotenv file. Use a JSON
+// pointer, ie. filepath:/run/secrets/db.json#/password, or a top level key, ie. filepath:/etc/app/secrets.env#DB_PASS.
+// Alternatives are separated by a pipe and tried in order, ie. filepath:/a|filepath:/b|default-value. A missing file
+// moves on to the next alternative, and the last alternative may be a literal value without the prefix. A path that
+// ends with a question mark is optional, ie. filepath:/run/secrets/token? leaves the string empty if the file is
+// missing. The output map contains the file that was used, or an empty string if a literal (or no) value was used.
+// Files named .gz (gzip) or .bz2 (bzip2) are decompressed; other files are never decompressed. Add an encoding to the prefix to decode a file, ie.
+// filepath+base64:/run/secrets/key or filepath+hex:/run/secrets/key. MaxSize applies to the decoded data.
+// Encrypted values, ie. enc:AES256GCM:<base64>, are decrypted with Opts.DecryptKey. They are not in the output map.
 func Parse(ptr interface{}, opts *Opts) (_ map[string]string, err error) {
 	if reflect.TypeOf(ptr).Kind() != reflect.Ptr {
 		return nil, ErrNotPtr
@@ -119,6 +158,10 @@ type parser struct {
 	CurrentDepth uint
 	// CurrentElement is the current (or last) element parsed. Returned in an error in case of panic.
 	CurrentElement string
+	// DryRun is set by Check. References are checked and saved to Checks, and nothing is read or changed.
+	DryRun bool
+	// Checks holds the result for each reference found during a dry run.
+	Checks []*CheckResult
 }
 
 // newParser returns a parser with attached Opts. Sets defaults for any omitted values.
@@ -130,9 +173,11 @@ func (input *Opts) newParser() *parser {
 			Prefix:        DefaultPrefix,
 			NoTrim:        false,
 			MaxSize:       DefaultMaxSize,
+			SelectMaxSize: DefaultSelectMaxSize,
 			MaxDepth:      DefaultMaxDepth,
 			TransformFile: defaultTransformer,
 			TransformPath: defaultTransformer,
+			Cache:         &FileCache{}, //nolint:exhaustruct
 		},
 		CurrentDepth:   0,
 		CurrentElement: DefaultName,
@@ -146,9 +191,14 @@ func (input *Opts) newParser() *parser {
 	output.Name = pick(input.Name, output.Name)
 	output.Prefix = pick(input.Prefix, output.Prefix)
 	output.MaxSize = pick(input.MaxSize, output.MaxSize)
+	output.SelectMaxSize = pick(input.SelectMaxSize, output.SelectMaxSize)
 	output.MaxDepth = pick(input.MaxDepth, output.MaxDepth)
 	output.TransformPath = pick(input.TransformPath, output.TransformPath)
 	output.TransformFile = pick(input.TransformFile, output.TransformFile)
+	output.Cache = pick(input.Cache, output.Cache)
+	output.DecryptKey = input.DecryptKey
+	output.DecryptKeyFile = input.DecryptKeyFile
+	output.Logger = input.Logger
 	output.CurrentElement = output.Name
 	output.NoTrim = input.NoTrim
 
@@ -237,6 +287,20 @@ func (p *parser) parseMap(elem reflect.Value, name string) error {
 	}
 
 	for _, key := range keys {
+		// Replace references to directories with an entry for each file in the directory.
+		if dirPath, enc, ok := p.dirReference(elem.MapIndex(key)); ok && elem.Type().Key().Kind() == reflect.String {
+			if p.DryRun {
+				p.check(elem.MapIndex(key).String(), fmt.Sprint(name, "[", key, "]"), true)
+				continue
+			}
+
+			if err := p.expandMap(elem, key, dirPath, enc, name); err != nil {
+				return err
+			}
+
+			continue
+		}
+
 		// Copy the map field type, using this ridiculous reflect magic.
 		elemCopy := reflect.Indirect(reflect.New(elem.MapIndex(key).Type()))
 		// Set the copy's value to the value of the original.
@@ -249,7 +313,9 @@ func (p *parser) parseMap(elem reflect.Value, name string) error {
 		}
 
 		// Update the map index with the possibly-modified copy that got parsed.
-		elem.SetMapIndex(key, elemCopy)
+		if !p.DryRun {
+			elem.SetMapIndex(key, elemCopy)
+		}
 	}
 
 	return nil
@@ -262,7 +328,23 @@ func (p *parser) parseSlice(slice reflect.Value, name string) error {
 		return nil // Avoid traversing byte slices and other things that don't contain strings.
 	}
 
+	if p.DryRun {
+		return p.checkSlice(slice, name)
+	}
+
+	// Replace references to directories with an element for each file in the directory.
+	expanded, err := p.expandSlice(slice, name)
+	if err != nil {
+		return err
+	}
+
+	length = slice.Len()
+
 	for idx := length - 1; idx >= 0; idx-- {
+		if expanded[idx] {
+			continue // Already read in from a directory.
+		}
+
 		p.CurrentElement = fmt.Sprintf("%s[%d/%d]", name, idx+1, length)
 		if err := p.Parse(slice.Index(idx), p.CurrentElement); err != nil {
 			return err
@@ -275,15 +357,30 @@ func (p *parser) parseSlice(slice reflect.Value, name string) error {
 // This parse function is non-recursive. The buck stops here, so to speak.
 // If the string has the correct prefix, and can be set, read the file and set it!
 func (p *parser) parseString(elem reflect.Value, name string) error {
-	value := elem.String()
-	if !elem.CanSet() || !strings.HasPrefix(value, p.Prefix) {
+	if p.DryRun {
+		if elem.CanSet() {
+			p.check(elem.String(), name, false)
+		}
+
+		return nil
+	}
+
+	if elem.CanSet() && p.isEncrypted(elem.String()) {
+		return p.parseEncrypted(elem, name)
+	}
+
+	value, encoding, ok := p.cutPrefix(elem.String())
+	if !elem.CanSet() || !ok {
 		return nil
 	}
 
 	// Save this parsed path to the output map. Remove the prefix and any enclosing whitespace.
-	p.Output[name] = strings.TrimSpace(strings.TrimPrefix(value, p.Prefix))
-	// Read in the file contents.
-	fileContent, err := p.readFile(p.TransformPath(p.Output[name]))
+	p.Output[name] = strings.TrimSpace(value)
+	// Read in the file contents, or a fallback value.
+	source, fileContent, err := p.resolveReference(p.Output[name], encoding)
+	// Save the source that was actually used. This is empty if a literal fallback was used.
+	p.Output[name] = source
+
 	if err != nil {
 		return &ElemError{ // Warp the error with our custom type.
 			Name:  name,
@@ -292,31 +389,117 @@ func (p *parser) parseString(elem reflect.Value, name string) error {
 		}
 	}
 
+	if source != "" {
+		fileContent = p.TransformFile(fileContent)
+	}
+
 	// Update the string element's value with the file contents.
-	elem.SetString(p.TransformFile(fileContent))
+	elem.SetString(fileContent)
 
 	return nil
 }
 
 // Read and return a file's contents according to requested byte size and trim or not.
-func (p *parser) readFile(filePath string) (string, error) {
+// Files are only read once per cache, so repeated references get identical content.
+func (p *parser) readFile(filePath, encoding string) (string, error) {
+	content, err := p.readContent(filePath, encoding, p.MaxSize)
+	if err != nil {
+		return "", err
+	}
+
+	if p.NoTrim { // Leave any newlines or other enclosing whitespace.
+		return string(content.data), nil
+	}
+
+	return string(bytes.TrimSpace(content.data)), nil
+}
+
+// readContent returns a file's contents, truncated to maxSize. Uses the cache.
+func (p *parser) readContent(filePath, encoding string, maxSize uint) (*fileContent, error) {
+	start := time.Now()
+
+	content, cached := p.Cache.get(filePath, encoding, maxSize)
+	if !cached {
+		var err error
+		if content, err = p.readRaw(filePath, encoding, maxSize); err != nil {
+			logEvent(p.Logger, "failed resolving file reference", err,
+				slog.String("element", p.CurrentElement),
+				slog.String("path", filePath),
+				slog.String("encoding", encoding),
+				slog.Duration("elapsed", time.Since(start)),
+			)
+
+			return nil, err
+		}
+
+		p.Cache.set(filePath, encoding, maxSize, content)
+	}
+
+	logEvent(p.Logger, "resolved file reference", nil,
+		slog.String("element", p.CurrentElement),
+		slog.String("path", filePath),
+		slog.String("encoding", encoding),
+		slog.String("compression", content.compression),
+		slog.Int("size", len(content.data)),
+		slog.Bool("truncated", content.truncated),
+		slog.Bool("cached", cached),
+		slog.Duration("elapsed", time.Since(start)),
+	)
+
+	return content, nil
+}
+
+// fileContent is the content of a file read by readRaw.
+type fileContent struct {
+	data []byte
+	// truncated is true if the file has more than MaxSize bytes.
+	truncated bool
+	// compression is the compression found by deCompressByName.
+	compression string
+}
+
+// readLimit returns a maximum size plus one byte, so truncated content can be detected. The result never overflows.
+func readLimit(maxSize uint) int64 {
+	if uint64(maxSize) >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+
+	return int64(maxSize) + 1
+}
+
+// readRaw opens a file and reads up to maxSize bytes from it. Compressed files are decompressed,
+// and encoded files are decoded. maxSize applies to the decompressed and decoded data.
+func (p *parser) readRaw(filePath, encoding string, maxSize uint) (*fileContent, error) {
 	fOpen, err := os.OpenFile(filePath, os.O_RDONLY, 0)
 	if err != nil {
-		return "", fmt.Errorf("opening file: %w", err)
+		return nil, fmt.Errorf("opening file: %w", err)
 	}
 	defer fOpen.Close()
 
-	// This is how .Read() works, it will return this many bytes (or less).
-	fileContent := make([]byte, p.MaxSize)
-	// size is the amount (count) of data (bytes) read.
-	size, err := fOpen.Read(fileContent)
-	if err != nil && !errors.Is(err, io.EOF) {
-		return "", fmt.Errorf("reading file: %w", err)
+	content := &fileContent{data: []byte{}}
+
+	reader, compression, err := deCompressByName(fOpen, filePath)
+	if errors.Is(err, io.EOF) {
+		return content, nil // Empty file.
+	} else if err != nil {
+		return nil, err
 	}
 
-	if p.NoTrim { // Leave any newlines or other enclosing whitespace.
-		return string(fileContent[:size]), nil
+	content.compression = compression
+
+	if reader, err = decoder(reader, encoding); err != nil {
+		return nil, err
+	}
+
+	// Never read more than maxSize bytes; this also protects against decompression bombs.
+	// One extra byte is read to find out if the content was truncated.
+	if content.data, err = io.ReadAll(io.LimitReader(reader, readLimit(maxSize))); err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
 	}
-	// The [:size] trims off the extra junk from the empty byte slice.
-	return string(bytes.TrimSpace(fileContent[:size])), nil
+
+	if content.truncated = uint(len(content.data)) > maxSize; content.truncated {
+		content.data = content.data[:maxSize]
+	}
+
+	return content, nil
 }
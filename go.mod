@@ -1,6 +1,6 @@
 module golift.io/cnfgfile
 
-go 1.19
+go 1.21
 
 require (
 	github.com/BurntSushi/toml v1.4.0
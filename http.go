@@ -0,0 +1,166 @@
+package cnfgfile
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// HTTPCache stores the body and validators (ETag and Last-Modified) of each URL fetched by UnmarshalWith.
+// Use it to avoid downloading unchanged config files every time you reload them.
+// The zero value is ready to use, and it's safe for concurrent use.
+type HTTPCache struct {
+	mu    sync.Mutex
+	items map[string]*httpCacheItem
+}
+
+// httpCacheItem is a single cached http response.
+type httpCacheItem struct {
+	etag        string
+	modified    string
+	contentType string
+	body        []byte
+}
+
+// Forget removes a URL from the cache, so the next request for it is unconditional.
+func (c *HTTPCache) Forget(location string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.items, location)
+}
+
+// Clear removes every URL from the cache.
+func (c *HTTPCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = nil
+}
+
+// get returns the cached item for a URL, or nil. Works on a nil cache.
+func (c *HTTPCache) get(location string) *httpCacheItem {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.items[location]
+}
+
+// set saves an item for a URL, if it has a validator. Works on a nil cache.
+func (c *HTTPCache) set(location string, item *httpCacheItem) {
+	if c == nil || (item.etag == "" && item.modified == "") {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.items == nil {
+		c.items = make(map[string]*httpCacheItem)
+	}
+
+	c.items[location] = item
+}
+
+// isURL returns true if a config file location is an http or https URL.
+func isURL(location string) bool {
+	lower := strings.ToLower(location)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// fetch downloads a URL and returns the body and the detected format of the body.
+// Uses a conditional request, and the cached body, if the URL is in the cache.
+func (u *unmarshaler) fetch(location string) ([]byte, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), u.HTTPTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("creating request: %w", err)
+	}
+
+	cached := u.HTTPCache.get(location)
+	if cached != nil {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+
+		if cached.modified != "" {
+			req.Header.Set("If-Modified-Since", cached.modified)
+		}
+	}
+
+	resp, err := u.HTTPClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		return cached.body, formatOfURL(location, cached.contentType), nil
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, "", fmt.Errorf("%w: %s (%w)", ErrHTTPStatus, resp.Status, fs.ErrNotExist)
+	case resp.StatusCode != http.StatusOK:
+		return nil, "", fmt.Errorf("%w: %s", ErrHTTPStatus, resp.Status)
+	}
+
+	// One extra byte is read to find out if the body is too large.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, readLimit(u.HTTPMaxSize)))
+	if err != nil {
+		return nil, "", fmt.Errorf("reading response body: %w", err)
+	} else if uint(len(body)) > u.HTTPMaxSize {
+		return nil, "", fmt.Errorf("%w: %d bytes", ErrHTTPSize, u.HTTPMaxSize)
+	}
+
+	u.HTTPCache.set(location, &httpCacheItem{
+		etag:        resp.Header.Get("ETag"),
+		modified:    resp.Header.Get("Last-Modified"),
+		contentType: resp.Header.Get("Content-Type"),
+		body:        body,
+	})
+
+	return body, formatOfURL(location, resp.Header.Get("Content-Type")), nil
+}
+
+// formatOfURL returns the format for a downloaded config file.
+// The content type is checked first, then the URL path, just like a file name.
+func formatOfURL(location, contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "application/json", "text/json":
+		return FormatJSON
+	case "application/xml", "text/xml":
+		return FormatXML
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return FormatYAML
+	case "application/toml", "text/toml":
+		return FormatTOML
+	}
+
+	switch {
+	case strings.HasSuffix(mediaType, "+json"):
+		return FormatJSON
+	case strings.HasSuffix(mediaType, "+xml"):
+		return FormatXML
+	case strings.HasSuffix(mediaType, "+yaml"):
+		return FormatYAML
+	}
+
+	if parsed, err := url.Parse(location); err == nil {
+		return FormatOf(parsed.Path)
+	}
+
+	return FormatOf(location)
+}
@@ -0,0 +1,143 @@
+package cnfgfile_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+// testServer serves the files in the tests folder.
+// Files requested with a ?type= query are served with that Content-Type.
+// Counts the 304 Not Modified responses it sends.
+func testServer(t *testing.T, notModified *int64) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+
+		data, err := os.ReadFile("tests" + req.URL.Path)
+		if err != nil {
+			http.NotFound(resp, req)
+			return
+		}
+
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt64(notModified, 1)
+			resp.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		resp.Header().Set("ETag", `"v1"`)
+		resp.Header().Set("Content-Type", req.URL.Query().Get("type"))
+		_, _ = resp.Write(data)
+	}))
+}
+
+func TestUnmarshalURL(t *testing.T) {
+	t.Parallel()
+
+	var notModified int64
+
+	server := testServer(t, &notModified)
+	defer server.Close()
+
+	for name, path := range map[string]string{
+		"json by suffix":       "/config.json",
+		"gz json by suffix":    "/config.json.gz?type=application/octet-stream",
+		"yaml by content type": "/config.yaml?type=application/x-yaml",
+		"bz2 yaml by type":     "/config.yaml.bz2?type=text/yaml",
+		"xml by content type":  "/config.xml?type=application/xml%3B%20charset%3Dutf-8",
+		"toml by default":      "/config.toml?type=text/plain",
+	} {
+		config := &testStruct{}
+		err := cnfgfile.Unmarshal(config, server.URL+path)
+		testUnmarshalValues(t, assert.New(t), config, err, name)
+	}
+
+	err := cnfgfile.Unmarshal(&testStruct{}, server.URL+"/config.toml?type=application/json")
+	require.ErrorContains(t, err, "unmarshaling file", "the content type must be preferred over the suffix")
+
+	err = cnfgfile.Unmarshal(&testStruct{}, server.URL+"/missing.json")
+	require.ErrorIs(t, err, cnfgfile.ErrHTTPStatus)
+}
+
+func TestUnmarshalURLCache(t *testing.T) {
+	t.Parallel()
+
+	var notModified int64
+
+	server := testServer(t, &notModified)
+	defer server.Close()
+
+	opts := &cnfgfile.UnmarshalOpts{HTTPCache: &cnfgfile.HTTPCache{}}
+
+	for idx := 0; idx < 3; idx++ {
+		config := &testStruct{}
+		loaded, err := cnfgfile.UnmarshalWith(config, opts, server.URL+"/config.yaml")
+		testUnmarshalValues(t, assert.New(t), config, err, "cached")
+		assert.Equal(t, []string{server.URL + "/config.yaml"}, loaded)
+	}
+
+	assert.EqualValues(t, 2, atomic.LoadInt64(&notModified), "the cached body must be used after the first request")
+
+	opts.HTTPCache.Forget(server.URL + "/config.yaml")
+
+	config := &testStruct{}
+	_, err := cnfgfile.UnmarshalWith(config, opts, server.URL+"/config.yaml")
+	testUnmarshalValues(t, assert.New(t), config, err, "forgotten")
+	assert.EqualValues(t, 2, atomic.LoadInt64(&notModified), "a forgotten URL must not make a conditional request")
+}
+
+func TestUnmarshalURLTimeout(t *testing.T) {
+	t.Parallel()
+
+	var notModified int64
+
+	server := testServer(t, &notModified)
+	defer server.Close()
+
+	opts := &cnfgfile.UnmarshalOpts{HTTPClient: server.Client(), HTTPTimeout: 10 * time.Millisecond}
+	_, err := cnfgfile.UnmarshalWith(&testStruct{}, opts, server.URL+"/slow")
+	require.ErrorContains(t, err, "fetching url "+server.URL+"/slow")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestUnmarshalURLMaxSize(t *testing.T) {
+	t.Parallel()
+
+	var notModified int64
+
+	server := testServer(t, &notModified)
+	defer server.Close()
+
+	opts := &cnfgfile.UnmarshalOpts{HTTPClient: server.Client(), HTTPMaxSize: 10}
+	_, err := cnfgfile.UnmarshalWith(&testStruct{}, opts, server.URL+"/config.json")
+	require.ErrorIs(t, err, cnfgfile.ErrHTTPSize)
+
+	opts.HTTPMaxSize = 100000
+	_, err = cnfgfile.UnmarshalWith(&testStruct{}, opts, server.URL+"/config.json")
+	require.NoError(t, err)
+}
+
+func TestUnmarshalURLOptional(t *testing.T) {
+	t.Parallel()
+
+	var notModified int64
+
+	server := testServer(t, &notModified)
+	defer server.Close()
+
+	loaded, err := cnfgfile.UnmarshalWith(&testStruct{}, nil, cnfgfile.OptionalPrefix+server.URL+"/missing.json")
+	require.NoError(t, err, "a missing optional URL must be skipped")
+	assert.Empty(t, loaded)
+}
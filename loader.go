@@ -0,0 +1,367 @@
+package cnfgfile
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Loader layers. Each layer overrides the values set by the layers before it.
+const (
+	LayerDefault  = "default"
+	LayerFile     = "file"
+	LayerEnv      = "env"
+	LayerOverride = "override"
+)
+
+// Source is the provenance of an element: the layer that set its final value, and where the value came from.
+type Source struct {
+	// Layer is the last layer that set the element: LayerDefault, LayerFile, LayerEnv or LayerOverride.
+	Layer string
+	// Name is the file name (or URL), the environment variable, or the override key. Empty for defaults.
+	Name string
+	// Reference is the file (or directory) Parse read the value from, if the value was a reference.
+	Reference string
+}
+
+// Loader loads a config in layers, and then calls Parse (and optionally Validate) with the result.
+// This replaces the steps most applications repeat in main(). The layers run in this order:
+//  1. The default struct tags, see SetDefaults.
+//  2. Files, in order, see UnmarshalWith.
+//  3. Environment variables that begin with EnvPrefix.
+//  4. The Overrides map, ie. from command line flags.
+//
+// Files are always unmarshaled with the same mapper the cnfg tag uses, so the Loader knows which elements each
+// file sets. Keys are matched like Unmarshal matches them, see KeyMatchDefault. Use UnmarshalOpts.KeyMatch
+// to ignore case, dashes and underscores.
+type Loader struct {
+	// Files are unmarshaled in order. See UnmarshalWith for the supported locations, ie. optional files.
+	Files []string
+	// EnvPrefix enables the environment layer. Each member that is not a struct or a map is read from a variable
+	// named after the prefix and the path to the member: the cnfg tag (or the member name) of each struct,
+	// upper-cased, and joined with underscores. Other characters become underscores too. The variable for
+	// Config.Server.ListenAddr with the prefix APP is APP_SERVER_LISTENADDR, or APP_SERVER_LISTEN_ADDR with a
+	// `cnfg:"listen_addr"` tag. Slices are comma separated lists, like the default tag.
+	// The json, yaml, toml and xml tags are not used, because the files may be in any format: a member with
+	// only a `json:"listen_addr"` tag is APP_SERVER_LISTENADDR. Add a cnfg tag to name it after its file key.
+	EnvPrefix string
+	// Overrides are set after the environment layer. The keys are paths like the environment variables,
+	// but joined with a dot and not case sensitive, ie. server.listen_addr. Load returns ErrUnknownKey if a key
+	// does not match a member, and ErrDuplicateKey if two keys differ only in case.
+	Overrides map[string]string
+	// UnmarshalOpts are used to unmarshal the files. May be nil.
+	UnmarshalOpts *UnmarshalOpts
+	// Opts are used by SetDefaults, Parse and Validate. May be nil.
+	Opts *Opts
+	// Validate makes Load call Validate after Parse.
+	Validate bool
+}
+
+// envName replaces everything that is not allowed in an environment variable name.
+var envName = regexp.MustCompile(`[^A-Z0-9_]+`)
+
+// Load runs every layer on a config, and then calls Parse. ptr must be a pointer to a struct.
+// Returns the provenance of every element that a layer set, ie. Config.Server.Port => {Layer: env,
+// Name: APP_SERVER_PORT}. The element names match those in errors, Parse output and SetDefaults output.
+// Slice and map elements are named after their index or key, ie. Config.Servers[1/2].Listen.
+func (l *Loader) Load(ptr interface{}) (map[string]Source, error) {
+	if ptr == nil || reflect.TypeOf(ptr).Kind() != reflect.Pointer ||
+		reflect.TypeOf(ptr).Elem().Kind() != reflect.Struct {
+		return nil, ErrNotStruct
+	}
+
+	sources := make(map[string]Source)
+
+	defaults, err := SetDefaults(ptr, l.Opts)
+	if err != nil {
+		return sources, err
+	}
+
+	for name := range defaults {
+		sources[name] = Source{Layer: LayerDefault}
+	}
+
+	if err := l.loadFiles(ptr, sources); err != nil {
+		return sources, err
+	}
+
+	if err := l.loadEnv(ptr, sources); err != nil {
+		return sources, err
+	}
+
+	if err := l.loadOverrides(ptr, sources); err != nil {
+		return sources, err
+	}
+
+	references, err := Parse(ptr, l.Opts)
+	if err != nil {
+		return sources, err
+	}
+
+	for name, reference := range references {
+		source := sources[name]
+		source.Reference = reference
+		sources[name] = source
+	}
+
+	if l.Validate {
+		return sources, Validate(ptr, l.Opts)
+	}
+
+	return sources, nil
+}
+
+// Load allocates a config of type T, unmarshals the files into it, and calls Parse.
+// T must be a struct; ErrNotStruct is returned otherwise. Returns the config, and the output from Parse.
+// This is the typed version of calling Unmarshal and Parse, use LoadWith to run every Loader layer.
+//
+//	config, _, err := cnfgfile.Load[Config]([]string{"/etc/app.conf"}, nil)
+func Load[T any](files []string, opts *Opts) (*T, map[string]string, error) {
+	config := new(T)
+	if reflect.TypeOf(config).Elem().Kind() != reflect.Struct {
+		return nil, nil, ErrNotStruct
+	}
+
+	if err := Unmarshal(config, files...); err != nil {
+		return nil, nil, err
+	}
+
+	output, err := Parse(config, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return config, output, nil
+}
+
+// LoadWith allocates a config of type T, and runs a Loader with it. loader may be nil, uses defaults.
+// T must be a struct; ErrNotStruct is returned otherwise. Returns the config, and the provenance of its elements.
+func LoadWith[T any](loader *Loader) (*T, map[string]Source, error) {
+	if loader == nil {
+		loader = &Loader{}
+	}
+
+	config := new(T)
+
+	sources, err := loader.Load(config)
+	if err != nil {
+		return nil, sources, err
+	}
+
+	return config, sources, nil
+}
+
+// loadFiles unmarshals each file, and saves the file as the source of the elements it sets.
+func (l *Loader) loadFiles(ptr interface{}, sources map[string]Source) error {
+	if len(l.Files) == 0 {
+		return nil
+	}
+
+	configName := l.Opts.newParser().Name
+	unmarshaler := l.UnmarshalOpts.newUnmarshaler()
+	_, err := unmarshaler.each(l.Files, func(fileName string) error {
+		unmarshaler.bound = make(map[string]bool)
+		if err := unmarshaler.unmarshal(ptr, fileName); err != nil {
+			return err
+		}
+
+		for name := range unmarshaler.bound {
+			sources[configName+strings.TrimPrefix(name, DefaultName)] = Source{Layer: LayerFile, Name: fileName}
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+// loadEnv sets the members that have an environment variable.
+func (l *Loader) loadEnv(ptr interface{}, sources map[string]Source) error {
+	if l.EnvPrefix == "" {
+		return nil
+	}
+
+	setter := l.newSetter(LayerEnv, sources, func(path []string) (string, string, bool) {
+		name := envName.ReplaceAllString(strings.ToUpper(l.EnvPrefix+"_"+strings.Join(path, "_")), "_")
+		value, ok := os.LookupEnv(name)
+
+		return value, name, ok
+	})
+
+	return setter.set(reflect.ValueOf(ptr), setter.Name, nil)
+}
+
+// loadOverrides sets the members that have an override, and makes sure every override is used.
+func (l *Loader) loadOverrides(ptr interface{}, sources map[string]Source) error {
+	if len(l.Overrides) == 0 {
+		return nil
+	}
+
+	keys := make(map[string]string, len(l.Overrides))
+	for key := range l.Overrides {
+		if other, ok := keys[strings.ToLower(key)]; ok {
+			pair := []string{key, other}
+			sort.Strings(pair)
+
+			return fmt.Errorf("overrides: %w: %s", ErrDuplicateKey, strings.Join(pair, ", "))
+		}
+
+		keys[strings.ToLower(key)] = key
+	}
+
+	used := make(map[string]bool)
+	setter := l.newSetter(LayerOverride, sources, func(path []string) (string, string, bool) {
+		key, ok := keys[strings.ToLower(strings.Join(path, "."))]
+		used[key] = ok
+
+		return l.Overrides[key], key, ok
+	})
+
+	if err := setter.set(reflect.ValueOf(ptr), setter.Name, nil); err != nil {
+		return err
+	}
+
+	unused := []string{}
+
+	for key := range l.Overrides {
+		if !used[key] {
+			unused = append(unused, key)
+		}
+	}
+
+	if len(unused) == 0 {
+		return nil
+	}
+
+	sort.Strings(unused)
+
+	return fmt.Errorf("overrides: %w: %s", ErrUnknownKey, strings.Join(unused, ", "))
+}
+
+// newSetter returns a setter for a layer. The lookup function returns the value and source name for a path.
+func (l *Loader) newSetter(layer string, sources map[string]Source,
+	lookup func(path []string) (string, string, bool),
+) *setter {
+	return &setter{
+		parser:  l.Opts.newParser(),
+		layer:   layer,
+		sources: sources,
+		lookup:  lookup,
+		active:  make(map[reflect.Type]bool),
+	}
+}
+
+// setter walks a data structure, and sets members from strings, ie. environment variables.
+type setter struct {
+	*parser
+	layer   string
+	sources map[string]Source
+	lookup  func(path []string) (string, string, bool)
+	// active contains the struct types that are being walked, so recursive pointers are not allocated forever.
+	active map[reflect.Type]bool
+	// count is the number of members that were set.
+	count int
+}
+
+// set recurses into structs and pointers to structs, and sets every member that has a value.
+// A nil pointer to a struct is only allocated if a member inside it is set.
+func (s *setter) set(elem reflect.Value, name string, path []string) error {
+	s.CurrentDepth++
+	defer func() { s.CurrentDepth-- }()
+
+	if s.CurrentDepth > s.MaxDepth {
+		return nil
+	}
+
+	if elem.Kind() == reflect.Pointer {
+		return s.setPointer(elem, name, path)
+	}
+
+	if elem.Kind() != reflect.Struct {
+		return nil
+	}
+
+	s.active[elem.Type()] = true
+	defer delete(s.active, elem.Type())
+
+	for _, field := range reflect.VisibleFields(elem.Type()) {
+		if len(field.Index) > 1 {
+			continue // Promoted fields are set with their embedded struct.
+		}
+
+		tag := parseFieldTag(field, CnfgTag)
+		member := elem.FieldByIndex(field.Index)
+
+		switch memberName := name + "." + field.Name; {
+		case tag.skip || tag.remain:
+		case tag.inline:
+			if err := s.set(member, name, path); err != nil {
+				return err
+			}
+		case !member.CanSet():
+		case isLeaf(field.Type):
+			if err := s.setLeaf(member, memberName, append(path, tag.key)); err != nil {
+				return err
+			}
+		default:
+			if err := s.set(member, memberName, append(path, tag.key)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// setPointer allocates a nil pointer to a struct if a member inside it is set.
+func (s *setter) setPointer(elem reflect.Value, name string, path []string) error {
+	if !elem.IsNil() {
+		return s.set(elem.Elem(), name, path)
+	}
+
+	if !elem.CanSet() || s.active[elem.Type().Elem()] {
+		return nil
+	}
+
+	count, value := s.count, reflect.New(elem.Type().Elem())
+	if err := s.set(value.Elem(), name, path); err != nil {
+		return err
+	}
+
+	if s.count > count {
+		elem.Set(value)
+	}
+
+	return nil
+}
+
+// setLeaf sets a member that is not a struct, if the lookup function finds a value for it.
+func (s *setter) setLeaf(elem reflect.Value, name string, path []string) error {
+	value, source, ok := s.lookup(path)
+	if !ok {
+		return nil
+	}
+
+	if err := setValue(elem, value); err != nil {
+		return &ElemError{Name: name, File: "", Inner: fmt.Errorf("%s %s: %w", s.layer, source, err)}
+	}
+
+	s.count++
+	s.sources[name] = Source{Layer: s.layer, Name: source}
+
+	return nil
+}
+
+// isLeaf returns true if a type is set from a single string: anything that is not an object or a list of objects.
+func isLeaf(typ reflect.Type) bool {
+	typ = derefType(typ)
+
+	if typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		return !isObject(typ.Elem()) && typ.Kind() == reflect.Slice
+	}
+
+	return !isObject(typ)
+}
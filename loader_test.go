@@ -0,0 +1,167 @@
+package cnfgfile_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+type loaderStruct struct {
+	Name     string            `cnfg:"name" default:"app"`
+	Port     int               `cnfg:"port" default:"80"`
+	Timeout  cnfgfile.Duration `cnfg:"timeout" default:"1m"`
+	Tags     []string          `cnfg:"tags"`
+	Password string            `cnfg:"password"`
+	Server   *loaderServer     `cnfg:"server"`
+	Debug    *loaderServer     `cnfg:"debug"`
+}
+
+type loaderServer struct {
+	ListenAddr string `cnfg:"listen_addr" validate:"required"`
+}
+
+func TestLoader(t *testing.T) { //nolint:paralleltest // t.Setenv cannot be used with t.Parallel.
+	t.Setenv("APP_PORT", "8080")
+	t.Setenv("APP_TAGS", "a,b")
+	t.Setenv("APP_SERVER_LISTEN_ADDR", ":1")
+	t.Setenv("APP_DEBUG_LISTEN_ADDR", "")
+
+	secret := writeFile(t, "password", []byte("hunter2"))
+	file := writeFile(t, "app.yaml", []byte("name: web\npassword: filepath:"+secret+"\nserver:\n  listen_addr: :2\n"))
+	config := &loaderStruct{}
+	loader := &cnfgfile.Loader{
+		Files:     []string{file},
+		EnvPrefix: "app",
+		Overrides: map[string]string{"Server.Listen_Addr": ":3"},
+	}
+
+	sources, err := loader.Load(config)
+	require.NoError(t, err)
+	assert.Equal(t, &loaderStruct{
+		Name:     "web",
+		Port:     8080,
+		Timeout:  cnfgfile.Duration{Duration: time.Minute},
+		Tags:     []string{"a", "b"},
+		Password: "hunter2",
+		Server:   &loaderServer{ListenAddr: ":3"},
+		Debug:    &loaderServer{ListenAddr: ""},
+	}, config)
+
+	assert.Equal(t, map[string]cnfgfile.Source{
+		"Config.Name":              {Layer: cnfgfile.LayerFile, Name: file},
+		"Config.Port":              {Layer: cnfgfile.LayerEnv, Name: "APP_PORT"},
+		"Config.Timeout":           {Layer: cnfgfile.LayerDefault},
+		"Config.Tags":              {Layer: cnfgfile.LayerEnv, Name: "APP_TAGS"},
+		"Config.Password":          {Layer: cnfgfile.LayerFile, Name: file, Reference: secret},
+		"Config.Server.ListenAddr": {Layer: cnfgfile.LayerOverride, Name: "Server.Listen_Addr"},
+		"Config.Debug.ListenAddr":  {Layer: cnfgfile.LayerEnv, Name: "APP_DEBUG_LISTEN_ADDR"},
+	}, sources)
+
+	var validErr *cnfgfile.ValidationError
+
+	_, err = (&cnfgfile.Loader{EnvPrefix: "app", Validate: true}).Load(&loaderStruct{})
+	require.ErrorAs(t, err, &validErr, "the empty debug listen address is required")
+	require.Len(t, validErr.Errors, 1)
+	assert.Equal(t, "Config.Debug.ListenAddr", validErr.Errors[0].Name)
+}
+
+func TestLoaderErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := (&cnfgfile.Loader{}).Load(loaderStruct{})
+	require.ErrorIs(t, err, cnfgfile.ErrNotStruct)
+
+	config := &loaderStruct{}
+	sources, err := (&cnfgfile.Loader{Overrides: map[string]string{"port": "1", "nope": "x", "server": "x"}}).Load(config)
+	require.ErrorIs(t, err, cnfgfile.ErrUnknownKey)
+	assert.Contains(t, err.Error(), "nope, server")
+	assert.Equal(t, cnfgfile.Source{Layer: cnfgfile.LayerOverride, Name: "port"}, sources["Config.Port"])
+	assert.Nil(t, config.Server, "pointers must only be allocated when a member is set")
+
+	config = &loaderStruct{}
+	_, err = (&cnfgfile.Loader{Overrides: map[string]string{"Port": "1", "port": "2", "name": "x"}}).Load(config)
+	require.ErrorIs(t, err, cnfgfile.ErrDuplicateKey)
+	assert.Contains(t, err.Error(), "Port, port")
+	assert.Equal(t, "app", config.Name, "no override must be set when keys differ only in case")
+
+	_, err = (&cnfgfile.Loader{Overrides: map[string]string{"port": "one"}}).Load(&loaderStruct{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Config.Port")
+
+	_, err = (&cnfgfile.Loader{Files: []string{"/no_file.yaml"}}).Load(&loaderStruct{})
+	require.Error(t, err)
+
+	sources, err = (&cnfgfile.Loader{
+		Files: []string{writeFile(t, "app.json", []byte(`{"port": 5}`))},
+		Opts:  &cnfgfile.Opts{Name: "App"},
+	}).Load(&loaderStruct{})
+	require.NoError(t, err)
+	assert.Equal(t, cnfgfile.LayerFile, sources["App.Port"].Layer, "names must use Opts.Name")
+	assert.Equal(t, cnfgfile.LayerDefault, sources["App.Name"].Layer)
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	secret := writeFile(t, "password", []byte("hunter2"))
+	file := writeFile(t, "app.toml", []byte("name = \"web\"\npassword = \"filepath:"+secret+"\"\n"))
+
+	config, output, err := cnfgfile.Load[loaderStruct]([]string{file}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &loaderStruct{Name: "web", Password: "hunter2"}, config, "Load must not set defaults")
+	assert.Equal(t, map[string]string{"Config.Password": secret}, output)
+
+	_, _, err = cnfgfile.Load[loaderStruct]([]string{"/no_file.toml"}, nil)
+	require.Error(t, err)
+
+	_, _, err = cnfgfile.Load[loaderStruct](nil, nil)
+	require.ErrorIs(t, err, cnfgfile.ErrNoFile)
+
+	_, _, err = cnfgfile.Load[*loaderStruct]([]string{file}, nil)
+	require.ErrorIs(t, err, cnfgfile.ErrNotStruct)
+
+	_, _, err = cnfgfile.Load[map[string]string]([]string{file}, nil)
+	require.ErrorIs(t, err, cnfgfile.ErrNotStruct)
+}
+
+func TestLoadWith(t *testing.T) {
+	t.Parallel()
+
+	file := writeFile(t, "app.json", []byte(`{"name": "web"}`))
+
+	config, sources, err := cnfgfile.LoadWith[loaderStruct](&cnfgfile.Loader{Files: []string{file}})
+	require.NoError(t, err)
+	assert.Equal(t, "web", config.Name)
+	assert.Equal(t, 80, config.Port)
+	assert.Equal(t, cnfgfile.Source{Layer: cnfgfile.LayerFile, Name: file}, sources["Config.Name"])
+
+	config, _, err = cnfgfile.LoadWith[loaderStruct](nil)
+	require.NoError(t, err)
+	assert.Equal(t, "app", config.Name)
+
+	_, _, err = cnfgfile.LoadWith[[]string](nil)
+	require.ErrorIs(t, err, cnfgfile.ErrNotStruct)
+}
+
+func TestLoaderMatchesUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	type jsonStruct struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	}
+
+	file := writeFile(t, "app.json", []byte(`{"Name": "x", "PORT": 1}`))
+
+	expected := &jsonStruct{}
+	require.NoError(t, cnfgfile.Unmarshal(expected, file))
+	assert.Equal(t, &jsonStruct{Name: "x", Port: 1}, expected, "encoding/json ignores case")
+
+	config, sources, err := cnfgfile.LoadWith[jsonStruct](&cnfgfile.Loader{Files: []string{file}})
+	require.NoError(t, err)
+	assert.Equal(t, expected, config, "the loader must match keys like Unmarshal does")
+	assert.Equal(t, cnfgfile.Source{Layer: cnfgfile.LayerFile, Name: file}, sources["Config.Port"])
+}
@@ -0,0 +1,37 @@
+package cnfgfile
+
+import (
+	"context"
+	"io"
+	"log/slog"
+)
+
+// logEvent sends an event to a logger, if one was provided. Errors are logged as warnings.
+// Never pass the content of a file (or any other secret value) to this function.
+func logEvent(logger *slog.Logger, msg string, err error, attrs ...slog.Attr) {
+	if logger == nil {
+		return
+	}
+
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	io.Reader
+	count int64
+}
+
+// Read satisfies the io.Reader interface.
+func (c *countingReader) Read(data []byte) (int, error) {
+	size, err := c.Reader.Read(data)
+	c.count += int64(size)
+
+	return size, err //nolint:wrapcheck // This is a reader, do not wrap io.EOF.
+}
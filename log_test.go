@@ -0,0 +1,118 @@
+package cnfgfile_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+// logEvents decodes the JSON log lines from a buffer.
+func logEvents(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	events := []map[string]interface{}{}
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		event := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		delete(event, "time")
+		delete(event, "elapsed")
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func TestUnmarshalLogger(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	opts := &cnfgfile.UnmarshalOpts{Logger: slog.New(slog.NewJSONHandler(&buf, nil))}
+	_, err := cnfgfile.UnmarshalWith(&testStruct{}, opts, "tests/config.json.gz", "tests/config.yaml")
+	require.NoError(t, err)
+
+	info, err := os.Stat("tests/config.json.gz")
+	require.NoError(t, err)
+
+	events := logEvents(t, &buf)
+	require.Len(t, events, 2)
+	assert.Equal(t, map[string]interface{}{
+		"level": "INFO", "msg": "loaded config file", "file": "tests/config.json.gz", "format": "json",
+		"compression": "gzip", "encrypted": false, "bytes": float64(info.Size()),
+	}, events[0])
+	assert.Equal(t, "yaml", events[1]["format"])
+
+	buf.Reset()
+
+	err = cnfgfile.Unmarshal(&testStruct{}, writeFile(t, "bad.json", []byte("{")))
+	require.Error(t, err)
+	assert.Empty(t, buf.String(), "the default is no logging")
+
+	_, err = cnfgfile.UnmarshalWith(&testStruct{}, opts, writeFile(t, "bad.json", []byte("{")))
+	require.Error(t, err)
+	events = logEvents(t, &buf)
+	require.Len(t, events, 1)
+	assert.Equal(t, "WARN", events[0]["level"])
+	assert.Equal(t, "failed loading config file", events[0]["msg"])
+}
+
+func TestParseLogger(t *testing.T) {
+	t.Parallel()
+
+	file := makeTextFile(t)
+	defer os.Remove(file)
+
+	var buf bytes.Buffer
+
+	data := &struct {
+		Key    string
+		Again  string
+		Binary string
+	}{
+		Key:    cnfgfile.DefaultPrefix + file,
+		Again:  cnfgfile.DefaultPrefix + file,
+		Binary: "filepath+hex:" + writeFile(t, "hex", []byte("6869")),
+	}
+
+	_, err := cnfgfile.Parse(data, &cnfgfile.Opts{MaxSize: 5, Logger: slog.New(slog.NewJSONHandler(&buf, nil))})
+	require.NoError(t, err)
+	assert.NotContains(t, buf.String(), "hi, th", "file content must never be logged")
+
+	events := logEvents(t, &buf)
+	require.Len(t, events, 3)
+	assert.Equal(t, map[string]interface{}{
+		"level": "INFO", "msg": "resolved file reference", "element": "Config.Key", "path": file, "encoding": "",
+		"compression": "", "size": float64(5), "truncated": true, "cached": false,
+	}, events[0])
+	assert.Equal(t, "Config.Again", events[1]["element"])
+	assert.Equal(t, true, events[1]["cached"])
+	assert.Equal(t, "hex", events[2]["encoding"])
+	assert.Equal(t, float64(2), events[2]["size"])
+	assert.Equal(t, false, events[2]["truncated"])
+}
+
+func TestParseLoggerFailure(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	data := &struct{ Key string }{Key: cnfgfile.DefaultPrefix + "/no_file"}
+	_, err := cnfgfile.Parse(data, &cnfgfile.Opts{Logger: slog.New(slog.NewJSONHandler(&buf, nil))})
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	events := logEvents(t, &buf)
+	require.Len(t, events, 1)
+	assert.Equal(t, "WARN", events[0]["level"])
+	assert.Equal(t, "failed resolving file reference", events[0]["msg"])
+	assert.Equal(t, "Config.Key", events[0]["element"])
+	assert.Equal(t, "/no_file", events[0]["path"])
+	assert.NotEmpty(t, events[0]["error"])
+}
@@ -0,0 +1,689 @@
+package cnfgfile
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	toml "github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// CnfgTag is the struct tag that sets the key of a member in every file format, so one tag replaces
+// the json, toml, xml and yaml tags, ie. `cnfg:"listen_addr"`. Options may follow the name:
+//   - omitempty skips the member in Marshal if it has a zero value.
+//   - inline (or squash) reads the members of a struct member from the parent, like an embedded struct.
+//   - remain collects every key that no other member uses into a map member.
+//
+// A member without a cnfg tag uses the format's tag, or the key the format's package uses by default,
+// ie. the member name, or the lower-cased name in yaml. This is decided for each member, so structs from
+// other packages keep their json or yaml keys. An embedded struct with cnfg tags is inlined in every format. Unmarshal (and UnmarshalWith) use this tag if a config
+// struct (or any struct inside it) has it. The file is decoded into a generic tree, see UnmarshalTree, and the
+// tree is copied into the struct; this works the same for every format. Strings are converted into numbers,
+// booleans and durations, and anything with an UnmarshalText method may be a string or a number. Members that
+// implement the file format's Unmarshaler interface, ie. json.Unmarshaler in a JSON file, decode their own value.
+const CnfgTag = "cnfg"
+
+// fieldTag is the key and options of a struct member, from the cnfg tag or a format's tag.
+type fieldTag struct {
+	key       string
+	skip      bool
+	inline    bool
+	remain    bool
+	omitEmpty bool
+	// cnfg is true if the key is from a cnfg tag.
+	cnfg bool
+	// path contains every element of an XML a>b tag, ie. [a b]. The key is the first one.
+	path []string
+}
+
+// parseFieldTag returns the key and options of a struct member. The cnfg tag is used if the member has one,
+// then the format's tag (json if format is empty). Members without a tag (or name) use the same default the
+// format's package uses. An embedded struct without a name is inlined, except in yaml without cnfg tags.
+func parseFieldTag(field reflect.StructField, format string) fieldTag {
+	tagName := pick(format, FormatJSON)
+
+	tag, ok := field.Tag.Lookup(CnfgTag)
+	if ok {
+		tagName = CnfgTag
+	} else {
+		tag = field.Tag.Get(tagName)
+	}
+
+	name, options, _ := strings.Cut(tag, ",")
+	hasOption := func(option string) bool { return strings.Contains(","+options+",", ","+option+",") }
+	output := fieldTag{key: name, skip: false, inline: false, remain: false, omitEmpty: hasOption("omitempty"), cnfg: ok, path: nil}
+
+	switch {
+	case name == "-" && options == "":
+		output.skip = true
+	case tagName == CnfgTag && (hasOption("inline") || hasOption("squash")):
+		output.inline = true
+	case tagName == CnfgTag && hasOption("remain"):
+		output.remain = true
+	case tagName == FormatYAML && hasOption("inline"):
+		output.inline = true
+	case name == "" && field.Anonymous && isStruct(field.Type) &&
+		(tagName != FormatYAML || usesCnfgTag(field.Type, map[reflect.Type]bool{})):
+		output.inline = true
+	case tagName == FormatXML && strings.Contains(name, ">"):
+		output.path = strings.Split(name, ">")
+		output.key = output.path[0] // Nested elements: a>b is a key named a.
+	}
+
+	switch {
+	case output.key != "":
+	case tagName == FormatYAML:
+		output.key = strings.ToLower(field.Name)
+	default:
+		output.key = field.Name
+	}
+
+	return output
+}
+
+// isStruct returns true if the type is a struct, or a pointer to one.
+func isStruct(typ reflect.Type) bool {
+	return derefType(typ).Kind() == reflect.Struct
+}
+
+// usesCnfgTag returns true if a type contains a cnfg tag anywhere inside it.
+// The seen map prevents infinite recursion with recursive types.
+func usesCnfgTag(typ reflect.Type, seen map[reflect.Type]bool) bool {
+	if typ == nil {
+		return false
+	}
+
+	for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice ||
+		typ.Kind() == reflect.Array || typ.Kind() == reflect.Map {
+		typ = typ.Elem()
+	}
+
+	if typ.Kind() != reflect.Struct || seen[typ] {
+		return false
+	}
+
+	seen[typ] = true
+
+	for idx := 0; idx < typ.NumField(); idx++ {
+		if _, ok := typ.Field(idx).Tag.Lookup(CnfgTag); ok || usesCnfgTag(typ.Field(idx).Type, seen) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// KeyMatch controls how Unmarshal matches the keys in a config file with struct members. See UnmarshalOpts.
+type KeyMatch uint8
+
+// Key matching modes. Every mode, except the default, unmarshals with the same mapper the cnfg tag uses,
+// so keys are matched the same way in every format. Exact matches always win. If a file has two keys
+// that match the same member, ie. name and Name, Unmarshal returns ErrDuplicateKey.
+const (
+	// KeyMatchDefault matches keys like each format's package: json and toml ignore case if no key
+	// matches exactly, and the others do not. Members with cnfg tags match keys exactly.
+	KeyMatchDefault KeyMatch = iota
+	// KeyMatchExact requires keys to be identical to the member's key in every format.
+	KeyMatchExact
+	// KeyMatchFold ignores case in every format, so Name, name and NAME are the same key.
+	KeyMatchFold
+	// KeyMatchNormalize ignores case, dashes and underscores in every format,
+	// so listenAddr, ListenAddr, listen_addr and listen-addr are the same key.
+	KeyMatchNormalize
+)
+
+// normalize returns a key in the form that is compared for this mode.
+func (k KeyMatch) normalize(key string) string {
+	switch k {
+	case KeyMatchFold:
+		return strings.ToLower(key)
+	case KeyMatchNormalize:
+		return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(key))
+	case KeyMatchDefault, KeyMatchExact:
+		fallthrough
+	default:
+		return key
+	}
+}
+
+// binder copies a generic tree into a data structure.
+type binder struct {
+	// format is the format of the file. Members without a cnfg tag use its tag, see parseFieldTag,
+	// and elements that implement its Unmarshaler interface are decoded by it.
+	format string
+	// match controls how keys are matched with members.
+	match KeyMatch
+	// bound collects the name of every element that is set, if it's not nil. Structs and maps are not included.
+	bound map[string]bool
+}
+
+// bind copies a value from a generic tree into an element. Maps and structs are merged, so files may be stacked.
+// Elements that implement the file format's Unmarshaler interface are handed their subtree, see decodeSubtree.
+// An interface element that contains a map (or a pointer) is merged too; other values are replaced.
+func (b *binder) bind(elem reflect.Value, node interface{}, name string) error {
+	if node == nil {
+		return nil // Null values do not change anything, like encoding/json.
+	}
+
+	switch elem.Kind() { //nolint:exhaustive // Everything else is bound from its type of node.
+	case reflect.Pointer:
+		if elem.IsNil() {
+			elem.Set(reflect.New(elem.Type().Elem()))
+		}
+
+		return b.bind(elem.Elem(), node, name)
+	case reflect.Interface:
+		if elem.NumMethod() != 0 {
+			return &ElemError{Name: name, File: "", Inner: fmt.Errorf("%w: %s", ErrUnsupportedType, elem.Type())}
+		}
+
+		if existing := elem.Elem(); mergeable(existing, node) {
+			return b.bind(existing, node, name)
+		}
+
+		elem.Set(reflect.ValueOf(node))
+		b.record(name)
+
+		return nil
+	}
+
+	if ok, err := b.decodeSubtree(elem, node); ok {
+		if err != nil {
+			return &ElemError{Name: name, File: "", Inner: err}
+		}
+
+		b.record(name)
+
+		return nil
+	}
+
+	var err error
+
+	switch val := node.(type) {
+	case map[string]interface{}:
+		return b.bindMap(elem, val, name)
+	case []interface{}:
+		err = b.bindList(elem, val, name)
+	default:
+		err = b.bindScalar(elem, node, name)
+	}
+
+	if err == nil {
+		b.record(name)
+	}
+
+	return err
+}
+
+// mergeable returns true if the existing value of an interface element is merged with a node, instead of
+// being replaced: a map is merged with a map, and a non-nil pointer is bound like any other pointer.
+func mergeable(existing reflect.Value, node interface{}) bool {
+	switch existing.Kind() { //nolint:exhaustive // Everything else is replaced.
+	case reflect.Pointer:
+		return !existing.IsNil()
+	case reflect.Map:
+		_, isMap := node.(map[string]interface{})
+		return isMap && !existing.IsNil()
+	default:
+		return false
+	}
+}
+
+// decodeSubtree hands a subtree to the file format's decoder, if the element implements that format's
+// Unmarshaler interface: json.Unmarshaler, yaml.Unmarshaler, toml.Unmarshaler or xml.Unmarshaler. The subtree
+// is encoded in the format again, except for TOML, which gets the decoded value. Returns false if the element
+// does not implement the interface, so the binder copies the subtree itself.
+func (b *binder) decodeSubtree(elem reflect.Value, node interface{}) (bool, error) {
+	if !elem.CanAddr() {
+		return false, nil
+	}
+
+	ptr := elem.Addr().Interface()
+
+	switch b.format {
+	case FormatJSON:
+		unmarshaler, ok := ptr.(json.Unmarshaler)
+		if !ok {
+			return false, nil
+		}
+
+		data, err := json.Marshal(node)
+		if err != nil {
+			return true, fmt.Errorf("encoding json: %w", err)
+		}
+
+		return true, unmarshaler.UnmarshalJSON(data) //nolint:wrapcheck // The caller wraps it.
+	case FormatYAML:
+		if _, ok := ptr.(yaml.Unmarshaler); !ok {
+			return false, nil
+		}
+
+		data, err := yaml.Marshal(node)
+		if err != nil {
+			return true, fmt.Errorf("encoding yaml: %w", err)
+		}
+
+		return true, yaml.Unmarshal(data, ptr) //nolint:wrapcheck // The caller wraps it.
+	case FormatXML:
+		if _, ok := ptr.(xml.Unmarshaler); !ok {
+			return false, nil
+		}
+
+		var buf bytes.Buffer
+		if err := encodeXML(&buf, xmlRoot, node, 0); err != nil {
+			return true, err
+		}
+
+		return true, xml.Unmarshal(buf.Bytes(), ptr) //nolint:wrapcheck // The caller wraps it.
+	case FormatTOML:
+		unmarshaler, ok := ptr.(toml.Unmarshaler)
+		if !ok {
+			return false, nil
+		}
+
+		return true, unmarshaler.UnmarshalTOML(node) //nolint:wrapcheck // The caller wraps it.
+	default:
+		return false, nil
+	}
+}
+
+// record saves the name of an element that was set, if the caller wants to know.
+func (b *binder) record(name string) {
+	if b.bound != nil {
+		b.bound[name] = true
+	}
+}
+
+// bindMap copies a map from a tree into a struct or a map.
+// XML does not have lists, so a single map may be bound to a slice or an array.
+func (b *binder) bindMap(elem reflect.Value, node map[string]interface{}, name string) error {
+	switch elem.Kind() { //nolint:exhaustive // Everything else is the wrong type.
+	case reflect.Struct:
+		return b.bindStruct(elem, node, name, map[string]bool{})
+	case reflect.Map:
+		if elem.IsNil() {
+			elem.Set(reflect.MakeMap(elem.Type()))
+		}
+
+		for key, value := range node {
+			if err := b.bindMapIndex(elem, key, value, name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case reflect.Slice, reflect.Array:
+		return b.bindList(elem, []interface{}{node}, name)
+	default:
+		return wrongType(elem, node, name)
+	}
+}
+
+// bindMapIndex copies a value into a map entry. An existing entry is merged.
+func (b *binder) bindMapIndex(elem reflect.Value, key string, node interface{}, name string) error {
+	name = fmt.Sprint(name, "[", key, "]")
+
+	mapKey := reflect.New(elem.Type().Key()).Elem()
+	if err := setValue(mapKey, key); err != nil {
+		return &ElemError{Name: name, File: "", Inner: err}
+	}
+
+	value := reflect.New(elem.Type().Elem()).Elem()
+	if existing := elem.MapIndex(mapKey); existing.IsValid() {
+		value.Set(existing)
+	}
+
+	if err := b.bind(value, node, name); err != nil {
+		return err
+	}
+
+	elem.SetMapIndex(mapKey, value)
+
+	return nil
+}
+
+// bindStruct copies the keys in a map into the members of a struct. Elements are named after the members.
+// The used map collects the keys that were bound, so a remain member gets the rest.
+func (b *binder) bindStruct(elem reflect.Value, node map[string]interface{}, name string, used map[string]bool) error {
+	var (
+		remain reflect.Value
+		index  = b.index(node)
+	)
+
+	for _, field := range reflect.VisibleFields(elem.Type()) {
+		if len(field.Index) > 1 {
+			continue // Promoted fields are bound with their embedded struct.
+		}
+
+		tag := parseFieldTag(field, b.format)
+		member := elem.FieldByIndex(field.Index)
+
+		switch {
+		case tag.skip:
+			continue
+		case tag.inline: // The exported members of an unexported embedded struct may be set.
+			if err := b.bindInline(member, node, name, used); err != nil {
+				return err
+			}
+		case !member.CanSet():
+			continue
+		case tag.remain:
+			remain = member
+		default:
+			key, ok, err := b.lookup(node, index, tag)
+			if err != nil {
+				return &ElemError{Name: name + "." + field.Name, File: "", Inner: err}
+			} else if !ok {
+				continue
+			}
+
+			used[key] = true
+
+			if err := b.bind(member, node[key], name+"."+field.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !remain.IsValid() {
+		return nil
+	}
+
+	rest := make(map[string]interface{})
+
+	for key, value := range node {
+		if !used[key] {
+			rest[key] = value
+		}
+	}
+
+	return b.bind(remain, rest, name)
+}
+
+// keyMatch returns the mode the binder matches keys with. KeyMatchDefault follows the format's package:
+// json and toml ignore case, and the others do not. Members with a cnfg tag are matched exactly by default.
+func (b *binder) keyMatch(tag fieldTag) KeyMatch {
+	switch {
+	case b.match != KeyMatchDefault:
+		return b.match
+	case !tag.cnfg && (b.format == FormatJSON || b.format == FormatTOML):
+		return KeyMatchFold
+	default:
+		return KeyMatchExact
+	}
+}
+
+// index returns the keys in a map by their normalized form, or nil if keys must always match exactly.
+func (b *binder) index(node map[string]interface{}) map[string][]string {
+	match := b.keyMatch(fieldTag{}) //nolint:exhaustruct // The mode for members without a cnfg tag.
+	if match != KeyMatchFold && match != KeyMatchNormalize {
+		return nil
+	}
+
+	index := make(map[string][]string, len(node))
+
+	for key := range node {
+		normal := match.normalize(key)
+		index[normal] = append(index[normal], key)
+	}
+
+	return index
+}
+
+// lookup finds the key for a member in a map. An exact match wins, then a key that matches after normalizing.
+func (b *binder) lookup(node map[string]interface{}, index map[string][]string, tag fieldTag) (string, bool, error) {
+	if _, ok := node[tag.key]; ok {
+		return tag.key, true, nil
+	}
+
+	match := b.keyMatch(tag)
+	if match == KeyMatchExact {
+		return "", false, nil
+	}
+
+	switch keys := index[match.normalize(tag.key)]; len(keys) {
+	case 0:
+		return "", false, nil
+	case 1:
+		return keys[0], true, nil
+	default:
+		sort.Strings(keys)
+		return "", false, fmt.Errorf("%w: %s", ErrDuplicateKey, strings.Join(keys, ", "))
+	}
+}
+
+// bindInline binds the parent's keys into an inlined struct (or map).
+func (b *binder) bindInline(member reflect.Value, node map[string]interface{}, name string, used map[string]bool) error {
+	for member.Kind() == reflect.Pointer {
+		if member.IsNil() {
+			if !member.CanSet() {
+				return nil
+			}
+
+			member.Set(reflect.New(member.Type().Elem()))
+		}
+
+		member = member.Elem()
+	}
+
+	if member.Kind() != reflect.Struct {
+		if !member.CanSet() {
+			return nil
+		}
+
+		return b.bind(member, node, name)
+	}
+
+	return b.bindStruct(member, node, name, used)
+}
+
+// bindList copies a list into a slice or an array. Slices are replaced, not merged.
+func (b *binder) bindList(elem reflect.Value, node []interface{}, name string) error {
+	switch elem.Kind() { //nolint:exhaustive // Everything else is the wrong type.
+	case reflect.Slice:
+		slice := reflect.MakeSlice(elem.Type(), len(node), len(node))
+
+		for idx, item := range node {
+			if err := b.bind(slice.Index(idx), item, fmt.Sprintf("%s[%d/%d]", name, idx+1, len(node))); err != nil {
+				return err
+			}
+		}
+
+		elem.Set(slice)
+	case reflect.Array:
+		for idx := 0; idx < elem.Len() && idx < len(node); idx++ {
+			if err := b.bind(elem.Index(idx), node[idx], fmt.Sprintf("%s[%d/%d]", name, idx+1, len(node))); err != nil {
+				return err
+			}
+		}
+	default:
+		return wrongType(elem, node, name)
+	}
+
+	return nil
+}
+
+// bindScalar copies a string, number, boolean or time into an element. Values that are not the same type as the
+// element are converted into a string and set with setValue, so "8080" works for a number, and 90 works for a
+// Duration. Strings are not split on commas for slices, like the default tag does; every format has lists.
+// XML does not, so a single XML value is bound to a slice with one item.
+func (b *binder) bindScalar(elem reflect.Value, node interface{}, name string) error {
+	value := reflect.ValueOf(node)
+
+	isText := reflect.PointerTo(elem.Type()).Implements(textUnmarshalerType)
+
+	switch {
+	case node == "" && !isText && (elem.Kind() == reflect.Struct || elem.Kind() == reflect.Map):
+		return nil // An empty XML element.
+	case elem.Kind() == reflect.Struct && !isText:
+		return wrongType(elem, node, name)
+	case value.Type().AssignableTo(elem.Type()):
+		elem.Set(value)
+		return nil
+	case elem.Kind() == reflect.Slice && elem.Type().Elem().Kind() == reflect.Uint8:
+		elem.SetBytes([]byte(scalarString(node)))
+		return nil
+	case (elem.Kind() == reflect.Slice || elem.Kind() == reflect.Array) && !isText && b.format == FormatXML:
+		return b.bindList(elem, []interface{}{node}, name)
+	case (elem.Kind() == reflect.Slice || elem.Kind() == reflect.Array) && !isText:
+		return wrongType(elem, node, name)
+	}
+
+	if err := setValue(elem, scalarString(node)); err != nil {
+		return &ElemError{Name: name, File: "", Inner: err}
+	}
+
+	return nil
+}
+
+// scalarString converts a scalar from a tree into a string.
+func scalarString(node interface{}) string {
+	switch val := node.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case encoding.TextMarshaler:
+		if text, err := val.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+
+	return fmt.Sprint(node)
+}
+
+// wrongType returns an error for a node that cannot be bound to an element.
+func wrongType(elem reflect.Value, node interface{}, name string) error {
+	return &ElemError{Name: name, File: "", Inner: fmt.Errorf("%w: cannot use %s for %s", ErrWrongType, jsonType(node), elem.Type())}
+}
+
+// Marshal encodes a data structure into a file format: json, yaml, toml or xml. Keys are chosen just like
+// Unmarshal chooses them: the cnfg tag is used if a member has one, then the format's tag. The omitempty,
+// inline and remain options of the cnfg tag are supported. Nil pointers are always skipped, and anything
+// with a MarshalText method becomes a string, so Secrets are redacted and Durations are written like 1m30s.
+func Marshal(config interface{}, format string) ([]byte, error) {
+	format = strings.ToLower(format)
+
+	tree, ok := toTree(reflect.ValueOf(config), format).(map[string]interface{})
+	if !ok {
+		return nil, ErrNotStruct
+	}
+
+	return EncodeTree(tree, format)
+}
+
+// toTree converts any value into a generic tree that EncodeTree encodes. Nil values return nil.
+func toTree(elem reflect.Value, format string) interface{} {
+	for elem.Kind() == reflect.Pointer || elem.Kind() == reflect.Interface {
+		if elem.IsNil() {
+			return nil
+		}
+
+		elem = elem.Elem()
+	}
+
+	if !elem.IsValid() {
+		return nil
+	}
+
+	switch val := elem.Interface().(type) {
+	case time.Time:
+		return val
+	case time.Duration:
+		return val.String()
+	case encoding.TextMarshaler:
+		text, _ := val.MarshalText()
+		return string(text)
+	}
+
+	switch elem.Kind() { //nolint:exhaustive // Everything else is a scalar.
+	case reflect.Struct:
+		tree := map[string]interface{}{}
+		structTree(tree, elem, format)
+
+		return tree
+	case reflect.Map:
+		if elem.IsNil() {
+			return nil
+		}
+
+		tree := make(map[string]interface{}, elem.Len())
+
+		for _, key := range elem.MapKeys() {
+			if value := toTree(elem.MapIndex(key), format); value != nil {
+				tree[fmt.Sprint(key)] = value
+			}
+		}
+
+		return tree
+	case reflect.Slice, reflect.Array:
+		if elem.Kind() == reflect.Slice && elem.Type().Elem().Kind() == reflect.Uint8 {
+			return string(elem.Bytes())
+		}
+
+		list := make([]interface{}, 0, elem.Len())
+		for idx := 0; idx < elem.Len(); idx++ {
+			list = append(list, toTree(elem.Index(idx), format))
+		}
+
+		return list
+	default:
+		return scalarValue(elem)
+	}
+}
+
+// structTree adds the members of a struct to a tree. Inlined members add their own members.
+func structTree(tree map[string]interface{}, elem reflect.Value, format string) {
+	for _, field := range reflect.VisibleFields(elem.Type()) {
+		if len(field.Index) > 1 {
+			continue
+		}
+
+		tag := parseFieldTag(field, format)
+		member := elem.FieldByIndex(field.Index)
+
+		if tag.skip || (!field.IsExported() && !tag.inline) || (tag.omitEmpty && member.IsZero()) {
+			continue
+		}
+
+		value := toTree(member, format)
+
+		switch inner, isMap := value.(map[string]interface{}); {
+		case value == nil:
+		case (tag.inline || tag.remain) && isMap:
+			for key, val := range inner {
+				tree[key] = val
+			}
+		default:
+			tree[tag.key] = value
+		}
+	}
+}
+
+// scalarValue converts a named string, number or boolean type into its basic type, so every encoder supports it.
+func scalarValue(elem reflect.Value) interface{} {
+	switch {
+	case elem.Kind() == reflect.String:
+		return elem.String()
+	case elem.Kind() == reflect.Bool:
+		return elem.Bool()
+	case elem.CanInt():
+		return elem.Int()
+	case elem.CanUint():
+		return elem.Uint()
+	case elem.CanFloat():
+		return elem.Float()
+	default:
+		return elem.Interface()
+	}
+}
@@ -0,0 +1,364 @@
+package cnfgfile_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+	"gopkg.in/yaml.v3"
+)
+
+type cnfgStruct struct {
+	Name     string                 `cnfg:"name"`
+	Port     int                    `cnfg:"port"`
+	Ratio    float64                `cnfg:"ratio,omitempty"`
+	Enabled  bool                   `cnfg:"enabled"`
+	Timeout  cnfgfile.Duration      `cnfg:"timeout"`
+	Wait     time.Duration          `cnfg:"wait"`
+	Size     cnfgfile.ByteSize      `cnfg:"size"`
+	Tags     []string               `cnfg:"tags"`
+	Ports    [2]uint16              `cnfg:"ports"`
+	Server   *cnfgServer            `cnfg:"server"`
+	Servers  []cnfgServer           `cnfg:"servers"`
+	Named    map[string]*cnfgServer `cnfg:"named"`
+	Skip     string                 `cnfg:"-"`
+	Untagged string
+	Embedded cnfgEmbed              `cnfg:",squash"`
+	Rest     map[string]interface{} `cnfg:",remain"`
+}
+
+type cnfgServer struct {
+	Listen string `cnfg:"listen"`
+	Debug  bool   `cnfg:"debug,omitempty"`
+}
+
+type cnfgEmbed struct {
+	Level string `cnfg:"level"`
+}
+
+func TestUnmarshalCnfgTag(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"config.toml": "name = 'app'\nport = 80\nratio = 0.5\nenabled = true\ntimeout = '1m'\nwait = '2s'\n" +
+			"size = '1KiB'\ntags = ['a', 'b']\nports = [1, 2]\nskip = 'x'\nUntagged = 'u'\nlevel = 'info'\nextra = 1\n" +
+			"[server]\nlisten = ':80'\n[[servers]]\nlisten = ':81'\n[named.one]\nlisten = ':82'\n",
+		"config.yaml": "name: app\nport: 80\nratio: 0.5\nenabled: true\ntimeout: 1m\nwait: 2s\nsize: 1KiB\n" +
+			"tags: [a, b]\nports: [1, 2]\nskip: x\nuntagged: u\nlevel: info\nextra: 1\nserver:\n  listen: :80\n" +
+			"servers:\n  - listen: :81\nnamed:\n  one:\n    listen: :82\n",
+		"config.json": `{"name": "app", "port": 80, "ratio": 0.5, "enabled": true, "timeout": "1m", "wait": "2s",
+			"size": "1KiB", "tags": ["a", "b"], "ports": [1, 2], "skip": "x", "Untagged": "u", "level": "info",
+			"extra": 1, "server": {"listen": ":80"}, "servers": [{"listen": ":81"}], "named": {"one": {"listen": ":82"}}}`,
+		// XML values are strings, and single elements are not lists.
+		"config.xml": "<config><name>app</name><port>80</port><ratio>0.5</ratio><enabled>true</enabled>" +
+			"<timeout>1m</timeout><wait>2s</wait><size>1KiB</size><tags>a</tags><tags>b</tags><ports>1</ports>" +
+			"<ports>2</ports><skip>x</skip><Untagged>u</Untagged><level>info</level><extra>1</extra>" +
+			"<server><listen>:80</listen></server><servers><listen>:81</listen></servers>" +
+			"<named><one><listen>:82</listen></one></named></config>",
+	}
+
+	for name, content := range files {
+		config := &cnfgStruct{}
+		require.NoError(t, cnfgfile.Unmarshal(config, writeFile(t, name, []byte(content))), name)
+		assert.Equal(t, &cnfgStruct{
+			Name:     "app",
+			Port:     80,
+			Ratio:    0.5,
+			Enabled:  true,
+			Timeout:  cnfgfile.Duration{Duration: time.Minute},
+			Wait:     2 * time.Second,
+			Size:     1024,
+			Tags:     []string{"a", "b"},
+			Ports:    [2]uint16{1, 2},
+			Server:   &cnfgServer{Listen: ":80"},
+			Servers:  []cnfgServer{{Listen: ":81"}},
+			Named:    map[string]*cnfgServer{"one": {Listen: ":82"}},
+			Untagged: "u",
+			Embedded: cnfgEmbed{Level: "info"},
+			Rest:     map[string]interface{}{"extra": config.Rest["extra"], "skip": "x"},
+		}, config, name)
+		assert.EqualValues(t, 1, config.Rest["extra"], name)
+	}
+}
+
+func TestUnmarshalCnfgTagStacked(t *testing.T) {
+	t.Parallel()
+
+	first := writeFile(t, "first.yaml", []byte("name: app\nserver:\n  listen: :80\nnamed:\n  one:\n    listen: :82\n"))
+	second := writeFile(t, "second.json", []byte(`{"server": {"debug": true}, "named": {"one": {"debug": true}}}`))
+
+	config := &cnfgStruct{}
+	require.NoError(t, cnfgfile.Unmarshal(config, first, second))
+	assert.Equal(t, "app", config.Name)
+	assert.Equal(t, &cnfgServer{Listen: ":80", Debug: true}, config.Server, "structs must be merged")
+	assert.Equal(t, &cnfgServer{Listen: ":82", Debug: true}, config.Named["one"], "map entries must be merged")
+
+	broken := writeFile(t, "broken.json", []byte(`{"server": {"debug": "maybe"}}`))
+	err := cnfgfile.Unmarshal(config, broken)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Config.Server.Debug")
+
+	broken = writeFile(t, "broken.yaml", []byte("server: [1]\n"))
+	require.ErrorIs(t, cnfgfile.Unmarshal(config, broken), cnfgfile.ErrWrongType)
+	require.ErrorIs(t, cnfgfile.Unmarshal(cnfgStruct{}, first), cnfgfile.ErrNotPtr)
+}
+
+func TestMarshal(t *testing.T) {
+	t.Parallel()
+
+	config := &cnfgStruct{
+		Name:     "app",
+		Timeout:  cnfgfile.Duration{Duration: time.Minute},
+		Server:   &cnfgServer{Listen: ":80"},
+		Embedded: cnfgEmbed{Level: "info"},
+		Rest:     map[string]interface{}{"extra": "x"},
+	}
+
+	for _, format := range []string{cnfgfile.FormatJSON, cnfgfile.FormatYAML, cnfgfile.FormatTOML, cnfgfile.FormatXML} {
+		data, err := cnfgfile.Marshal(config, format)
+		require.NoError(t, err, format)
+		assert.NotContains(t, string(data), "ratio", "omitempty must skip zero values")
+		assert.NotContains(t, string(data), "debug", "omitempty must skip zero values")
+
+		output := &cnfgStruct{}
+		require.NoError(t, cnfgfile.Unmarshal(output, writeFile(t, "config."+format, data)), string(data))
+		assert.Equal(t, config.Name, output.Name, format)
+		assert.Equal(t, config.Timeout, output.Timeout, format)
+		assert.Equal(t, config.Server, output.Server, format)
+		assert.Equal(t, config.Embedded, output.Embedded, format)
+		assert.Equal(t, "x", output.Rest["extra"], format)
+	}
+
+	_, err := cnfgfile.Marshal("string", cnfgfile.FormatJSON)
+	require.ErrorIs(t, err, cnfgfile.ErrNotStruct)
+}
+
+func TestUnmarshalCnfgTagEmbedded(t *testing.T) {
+	t.Parallel()
+
+	type config struct {
+		cnfgEmbed
+		*cnfgServer
+		Name string `cnfg:"name"`
+	}
+
+	output := &config{}
+	require.NoError(t, cnfgfile.Unmarshal(output, writeFile(t, "embed.yaml", []byte("name: a\nlevel: b\nlisten: c\n"))))
+	assert.Equal(t, &config{Name: "a", cnfgEmbed: cnfgEmbed{Level: "b"}}, output,
+		"unexported embedded structs are inlined, but nil pointers cannot be allocated")
+}
+
+func TestCnfgTagSchema(t *testing.T) {
+	t.Parallel()
+
+	schema, err := cnfgfile.NewSchema(&cnfgStruct{}, cnfgfile.FormatYAML)
+	require.NoError(t, err)
+	assert.Contains(t, schema.Properties, "timeout", "the cnfg tag is used in every format")
+	assert.Contains(t, schema.Properties, "level", "squashed members belong to the parent")
+	assert.Contains(t, schema.Properties, "untagged", "members without a cnfg tag use the format's key")
+	assert.NotContains(t, schema.Properties, "Embedded")
+	assert.NotContains(t, schema.Properties, "Rest")
+	assert.Equal(t, &cnfgfile.Schema{}, schema.AdditionalProperties, "remain allows any other key")
+}
+
+type keyMatchStruct struct {
+	ListenAddr string
+	MaxConns   int `json:"maxConns" toml:"max_conns" xml:"max-conns" yaml:"max_conns"`
+	Server     struct {
+		TimeoutSec int
+	}
+}
+
+func TestUnmarshalKeyMatch(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"a.yaml": "listen_addr: :80\nMAX-CONNS: 5\nserver:\n  timeout-sec: 3\n",
+		"b.json": `{"listen-addr": ":80", "MaxConns": 5, "SERVER": {"timeout_sec": 3}}`,
+		"c.toml": "ListenAddr = ':80'\nmaxConns = 5\n[server]\nTimeoutSec = 3\n",
+		"d.xml":  "<config><listenAddr>:80</listenAddr><max_conns>5</max_conns><Server><timeoutSec>3</timeoutSec></Server></config>",
+	}
+
+	expected := &keyMatchStruct{ListenAddr: ":80", MaxConns: 5}
+	expected.Server.TimeoutSec = 3
+
+	for name, content := range files {
+		config := &keyMatchStruct{}
+		opts := &cnfgfile.UnmarshalOpts{KeyMatch: cnfgfile.KeyMatchNormalize}
+		_, err := cnfgfile.UnmarshalWith(config, opts, writeFile(t, name, []byte(content)))
+		require.NoError(t, err, name)
+		assert.Equal(t, expected, config, name)
+	}
+
+	fold := writeFile(t, "fold.yaml", []byte("LISTENADDR: :80\nlisten_addr: :81\nserver:\n  timeoutsec: 3\n"))
+	config := &keyMatchStruct{}
+	_, err := cnfgfile.UnmarshalWith(config, &cnfgfile.UnmarshalOpts{KeyMatch: cnfgfile.KeyMatchFold}, fold)
+	require.NoError(t, err)
+	assert.Equal(t, ":80", config.ListenAddr, "dashes and underscores are not ignored when folding case")
+	assert.Equal(t, 3, config.Server.TimeoutSec)
+
+	// encoding/json ignores case by default. The exact mode makes it act like the others.
+	exact := writeFile(t, "exact.json", []byte(`{"listenaddr": ":80", "maxConns": 5}`))
+	config = &keyMatchStruct{}
+	_, err = cnfgfile.UnmarshalWith(config, &cnfgfile.UnmarshalOpts{KeyMatch: cnfgfile.KeyMatchExact}, exact)
+	require.NoError(t, err)
+	assert.Equal(t, &keyMatchStruct{MaxConns: 5}, config)
+
+	require.NoError(t, cnfgfile.Unmarshal(config, exact))
+	assert.Equal(t, ":80", config.ListenAddr)
+
+	duplicate := writeFile(t, "duplicate.json", []byte(`{"listen_addr": ":80", "listen-addr": ":81"}`))
+	_, err = cnfgfile.UnmarshalWith(config, &cnfgfile.UnmarshalOpts{KeyMatch: cnfgfile.KeyMatchNormalize}, duplicate)
+	require.ErrorIs(t, err, cnfgfile.ErrDuplicateKey)
+	assert.Contains(t, err.Error(), "listen-addr, listen_addr")
+}
+
+// unmarshalerValue has an Unmarshaler for every format. Each one saves the format and the name key in a map.
+type unmarshalerValue struct {
+	Format string
+	Value  string
+}
+
+func (u *unmarshalerValue) UnmarshalJSON(data []byte) error {
+	value := map[string]string{}
+	u.Format = "json"
+
+	defer func() { u.Value = value["name"] }()
+
+	return json.Unmarshal(data, &value)
+}
+
+func (u *unmarshalerValue) UnmarshalYAML(node *yaml.Node) error {
+	value := map[string]string{}
+	u.Format = "yaml"
+
+	defer func() { u.Value = value["name"] }()
+
+	return node.Decode(&value)
+}
+
+func (u *unmarshalerValue) UnmarshalTOML(data interface{}) error {
+	value, _ := data.(map[string]interface{})
+	u.Format = "toml"
+	u.Value, _ = value["name"].(string)
+
+	return nil
+}
+
+func (u *unmarshalerValue) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	value := struct {
+		Name string `xml:"name"`
+	}{}
+	u.Format = "xml"
+
+	defer func() { u.Value = value.Name }()
+
+	return decoder.DecodeElement(&value, &start)
+}
+
+type unmarshalerStruct struct {
+	Custom  unmarshalerValue  `cnfg:"custom"`
+	Pointer *unmarshalerValue `cnfg:"pointer"`
+	Any     interface{}       `cnfg:"any"`
+}
+
+type unmarshalerPlain struct {
+	Custom unmarshalerValue
+}
+
+func TestUnmarshalCnfgTagUnmarshaler(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"json": `{"custom": {"name": "x"}, "pointer": {"name": "y"}}`,
+		"yaml": "custom:\n  name: x\npointer:\n  name: y\n",
+		"toml": "[custom]\nname = 'x'\n[pointer]\nname = 'y'\n",
+		"xml":  "<config><custom><name>x</name></custom><pointer><name>y</name></pointer></config>",
+	}
+
+	for format, content := range files {
+		file := writeFile(t, "config."+format, []byte(content))
+
+		config := &unmarshalerStruct{}
+		require.NoError(t, cnfgfile.Unmarshal(config, file), format)
+		assert.Equal(t, unmarshalerValue{Format: format, Value: "x"}, config.Custom, format)
+		assert.Equal(t, &unmarshalerValue{Format: format, Value: "y"}, config.Pointer, format)
+
+		// KeyMatch and the Loader use the same mapper.
+		plain := &unmarshalerPlain{}
+		opts := &cnfgfile.UnmarshalOpts{KeyMatch: cnfgfile.KeyMatchFold}
+		_, err := cnfgfile.UnmarshalWith(plain, opts, file)
+		require.NoError(t, err, format)
+		assert.Equal(t, unmarshalerValue{Format: format, Value: "x"}, plain.Custom, format)
+
+		config = &unmarshalerStruct{}
+		sources, err := (&cnfgfile.Loader{Files: []string{file}}).Load(config)
+		require.NoError(t, err, format)
+		assert.Equal(t, unmarshalerValue{Format: format, Value: "x"}, config.Custom, format)
+		assert.Equal(t, cnfgfile.Source{Layer: cnfgfile.LayerFile, Name: file}, sources["Config.Custom"], format)
+	}
+}
+
+func TestUnmarshalCnfgTagInterface(t *testing.T) {
+	t.Parallel()
+
+	first := writeFile(t, "first.json", []byte(`{"any": {"a": 1, "nested": {"b": 2}}}`))
+	second := writeFile(t, "second.yaml", []byte("any:\n  c: 3\n  nested:\n    d: 4\n"))
+
+	config := &unmarshalerStruct{}
+	require.NoError(t, cnfgfile.Unmarshal(config, first, second))
+	assert.Equal(t, map[string]interface{}{
+		"a":      int64(1),
+		"c":      3,
+		"nested": map[string]interface{}{"b": int64(2), "d": 4},
+	}, config.Any, "maps in interfaces must be merged")
+
+	third := writeFile(t, "third.json", []byte(`{"any": "replaced"}`))
+	require.NoError(t, cnfgfile.Unmarshal(config, third))
+	assert.Equal(t, "replaced", config.Any, "other values must be replaced")
+
+	pointer := &unmarshalerValue{Format: "none"}
+	config = &unmarshalerStruct{Any: pointer}
+	require.NoError(t, cnfgfile.Unmarshal(config, writeFile(t, "pointer.json", []byte(`{"any": {"name": "z"}}`))))
+	assert.Same(t, pointer, config.Any, "pointers in interfaces must be bound, not replaced")
+	assert.Equal(t, &unmarshalerValue{Format: "json", Value: "z"}, pointer)
+}
+
+func TestUnmarshalCnfgTagPerMember(t *testing.T) {
+	t.Parallel()
+
+	// thirdParty is a struct from another package. It has format tags, but no cnfg tags.
+	type thirdParty struct {
+		APIKey string `json:"api_key" xml:"api_key" yaml:"api_key"`
+	}
+
+	type config struct {
+		Name   string     `cnfg:"name"`
+		Client thirdParty `cnfg:"client"`
+		Tags   []string   `cnfg:"tags"`
+	}
+
+	for name, content := range map[string]string{
+		"config.json": `{"name": "app", "client": {"api_key": "x"}, "tags": ["a,b"]}`,
+		"config.yaml": "name: app\nclient:\n  api_key: x\ntags: ['a,b']\n",
+		"config.xml":  "<config><name>app</name><client><api_key>x</api_key></client><tags>a,b</tags></config>",
+	} {
+		output := &config{}
+		require.NoError(t, cnfgfile.Unmarshal(output, writeFile(t, name, []byte(content))), name)
+		assert.Equal(t, "x", output.Client.APIKey, "members without a cnfg tag must use the format's tag: "+name)
+		assert.NotEqual(t, []string{"a", "b"}, output.Tags, "lists must not be split on commas: "+name)
+	}
+
+	for name, content := range map[string]string{
+		"config.json": `{"tags": "a,b"}`,
+		"config.yaml": "tags: a,b\n",
+		"config.toml": "tags = 'a,b'\n",
+	} {
+		err := cnfgfile.Unmarshal(&config{}, writeFile(t, name, []byte(content)))
+		require.ErrorIs(t, err, cnfgfile.ErrWrongType, "a string is not a list: "+name)
+	}
+}
@@ -0,0 +1,706 @@
+package cnfgfile
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DescTag is the struct tag NewSchema reads property descriptions from, ie. `desc:"The listen address."`.
+const DescTag = "desc"
+
+// SchemaDialect is the JSON Schema version NewSchema generates.
+const SchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Errors returned by NewSchema and Schema.Validate.
+var (
+	ErrNotStruct  = errors.New("must provide a struct or a pointer to a struct")
+	ErrWrongType  = errors.New("value has the wrong type")
+	ErrUnknownKey = errors.New("unknown key")
+)
+
+// JSON Schema types.
+const (
+	schemaNull    = "null"
+	schemaBool    = "boolean"
+	schemaInt     = "integer"
+	schemaNumber  = "number"
+	schemaString  = "string"
+	schemaArray   = "array"
+	schemaObject  = "object"
+	schemaDefsRef = "#/$defs/"
+)
+
+// SchemaType is the type (or list of types) a JSON Schema allows. A single type is encoded as a string.
+type SchemaType []string
+
+// MarshalJSON encodes a single type as a string, and multiple types as a list.
+func (s SchemaType) MarshalJSON() ([]byte, error) {
+	if len(s) == 1 {
+		return json.Marshal(s[0]) //nolint:wrapcheck
+	}
+
+	return json.Marshal([]string(s)) //nolint:wrapcheck
+}
+
+// Schema is a JSON Schema. NewSchema creates one from a config struct; encode it with encoding/json
+// to use it in an editor or CI. Only the keywords NewSchema generates are supported by Validate.
+type Schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        SchemaType         `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Default     interface{}        `json:"default,omitempty"`
+	Enum        []interface{}      `json:"enum,omitempty"`
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Maximum     *float64           `json:"maximum,omitempty"`
+	MinLength   *int               `json:"minLength,omitempty"`
+	MaxLength   *int               `json:"maxLength,omitempty"`
+	Pattern     string             `json:"pattern,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	MinItems    *int               `json:"minItems,omitempty"`
+	MaxItems    *int               `json:"maxItems,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	// AdditionalProperties is nil (any key is allowed), false (no other keys are allowed), or a *Schema.
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	MinProperties        *int               `json:"minProperties,omitempty"`
+	MaxProperties        *int               `json:"maxProperties,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+}
+
+//nolint:gochecknoglobals
+var (
+	durationType        = reflect.TypeOf((*durationer)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// NewSchema generates a JSON Schema from a config struct. The property names are read from the struct tags
+// of a file format (json, yaml, toml or xml), or json if format is empty. Members without a tag use the same
+// names the format's package does. The desc tag becomes the description, and the default tag becomes the
+// default. The validate tag is converted into keywords: required, min, max, oneof and regexp are supported.
+// Pointers may be null, and Duration, time.Duration and ByteSize accept a string or a number. Structs do
+// not allow unknown keys, so typos are caught. Recursive types are placed in $defs.
+func NewSchema(config interface{}, format string) (*Schema, error) {
+	typ := reflect.TypeOf(config)
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, ErrNotStruct
+	}
+
+	gen := &schemaGen{
+		format: strings.ToLower(format),
+		root:   typ,
+		defs:   make(map[string]*Schema),
+		names:  make(map[reflect.Type]string),
+		active: make(map[reflect.Type]bool),
+	}
+
+	schema, err := gen.structSchema(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	schema.Schema = SchemaDialect
+	schema.Title = typ.Name()
+
+	if len(gen.defs) > 0 {
+		schema.Defs = gen.defs
+	}
+
+	return schema, nil
+}
+
+// schemaGen generates a schema from a type.
+type schemaGen struct {
+	format string
+	root   reflect.Type
+	defs   map[string]*Schema
+	// names contains the $defs name of every recursive type.
+	names map[reflect.Type]string
+	// active contains the struct types that are being generated, to detect recursion.
+	active map[reflect.Type]bool
+}
+
+// typeSchema returns the schema for any type. Pointers may be null.
+func (g *schemaGen) typeSchema(typ reflect.Type) (*Schema, error) {
+	nullable := false
+
+	for typ.Kind() == reflect.Pointer {
+		typ, nullable = typ.Elem(), true
+	}
+
+	schema, err := g.kindSchema(typ)
+	if err == nil && nullable && len(schema.Type) > 0 {
+		schema.Type = append(schema.Type, schemaNull)
+	}
+
+	return schema, err
+}
+
+// kindSchema returns the schema for a type that is not a pointer.
+func (g *schemaGen) kindSchema(typ reflect.Type) (*Schema, error) {
+	switch {
+	case typ.Implements(durationType) || typ == reflect.TypeOf(time.Duration(0)) || typ == reflect.TypeOf(ByteSize(0)):
+		return &Schema{Type: SchemaType{schemaString, schemaNumber}}, nil
+	case typ == timeType:
+		return &Schema{Type: SchemaType{schemaString}, Format: "date-time"}, nil
+	case reflect.PointerTo(typ).Implements(textUnmarshalerType):
+		return &Schema{Type: SchemaType{schemaString}}, nil
+	}
+
+	switch typ.Kind() { //nolint:exhaustive // Other kinds allow any value.
+	case reflect.Bool:
+		return &Schema{Type: SchemaType{schemaBool}}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: SchemaType{schemaInt}}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: SchemaType{schemaInt}, Minimum: new(float64)}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: SchemaType{schemaNumber}}, nil
+	case reflect.String:
+		return &Schema{Type: SchemaType{schemaString}}, nil
+	case reflect.Slice, reflect.Array:
+		return g.listSchema(typ)
+	case reflect.Map:
+		items, err := g.typeSchema(typ.Elem())
+		return &Schema{Type: SchemaType{schemaObject}, AdditionalProperties: items}, err
+	case reflect.Struct:
+		return g.structSchema(typ)
+	default:
+		return &Schema{}, nil
+	}
+}
+
+// listSchema returns the schema for a slice or an array. Byte slices are strings.
+func (g *schemaGen) listSchema(typ reflect.Type) (*Schema, error) {
+	if typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8 {
+		return &Schema{Type: SchemaType{schemaString}}, nil
+	}
+
+	items, err := g.typeSchema(typ.Elem())
+	schema := &Schema{Type: SchemaType{schemaArray}, Items: items}
+
+	if typ.Kind() == reflect.Array {
+		length := typ.Len()
+		schema.MinItems, schema.MaxItems = &length, &length
+	}
+
+	return schema, err
+}
+
+// structSchema returns the schema for a struct, or a $ref if the struct is recursive.
+func (g *schemaGen) structSchema(typ reflect.Type) (*Schema, error) {
+	if name, ok := g.names[typ]; ok && g.defs[name] != nil {
+		return &Schema{Ref: schemaDefsRef + name}, nil
+	}
+
+	if g.active[typ] {
+		return &Schema{Ref: g.defRef(typ)}, nil
+	}
+
+	g.active[typ] = true
+	defer delete(g.active, typ)
+
+	schema := &Schema{Type: SchemaType{schemaObject}, Properties: map[string]*Schema{}, AdditionalProperties: false}
+	if err := g.addFields(schema, typ); err != nil {
+		return nil, err
+	}
+
+	if name, ok := g.names[typ]; ok && typ != g.root {
+		g.defs[name] = schema
+		return &Schema{Ref: schemaDefsRef + name}, nil
+	}
+
+	return schema, nil
+}
+
+// defRef returns the $ref for a recursive struct, and picks a unique $defs name for it.
+func (g *schemaGen) defRef(typ reflect.Type) string {
+	if typ == g.root {
+		return "#"
+	}
+
+	if name, ok := g.names[typ]; ok {
+		return schemaDefsRef + name
+	}
+
+	name := typ.Name()
+	if name == "" {
+		name = "struct"
+	}
+
+	for idx, taken := 2, name; ; idx++ {
+		if !g.nameTaken(taken) {
+			name = taken
+			break
+		}
+
+		taken = name + strconv.Itoa(idx)
+	}
+
+	g.names[typ] = name
+
+	return schemaDefsRef + name
+}
+
+func (g *schemaGen) nameTaken(name string) bool {
+	for _, taken := range g.names {
+		if taken == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addFields adds a property for each member of a struct. Inlined members add their own members.
+func (g *schemaGen) addFields(schema *Schema, typ reflect.Type) error {
+	for _, field := range reflect.VisibleFields(typ) {
+		if len(field.Index) > 1 {
+			continue // Promoted fields are added with their embedded struct.
+		}
+
+		// The members of an unexported embedded struct may be inlined.
+		tag := parseFieldTag(field, g.format)
+		key, inline := tag.key, tag.inline || tag.remain
+
+		if tag.skip || (!inline && !field.IsExported()) {
+			continue
+		}
+
+		if inline {
+			if err := g.addInline(schema, field.Type); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		prop, err := g.fieldSchema(schema, field, key)
+		if err != nil {
+			return &ElemError{Name: typ.Name() + "." + field.Name, File: "", Inner: err}
+		}
+
+		schema.Properties[key] = prop
+	}
+
+	return nil
+}
+
+// addInline adds the members of an inlined struct, or allows any key with the value type of an inlined map.
+func (g *schemaGen) addInline(schema *Schema, typ reflect.Type) error {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if typ.Kind() == reflect.Map {
+		items, err := g.typeSchema(typ.Elem())
+		schema.AdditionalProperties = items
+
+		return err
+	}
+
+	if g.active[typ] {
+		return nil // An inlined struct that inlines itself has nothing more to add.
+	}
+
+	g.active[typ] = true
+	defer delete(g.active, typ)
+
+	return g.addFields(schema, typ)
+}
+
+// fieldSchema returns the schema for a struct member, with its description, default and validate rules.
+func (g *schemaGen) fieldSchema(parent *Schema, field reflect.StructField, key string) (*Schema, error) {
+	prop, err := g.typeSchema(field.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	prop.Description = field.Tag.Get(DescTag)
+
+	if value, ok := field.Tag.Lookup(DefaultTag); ok {
+		elem := reflect.New(field.Type).Elem()
+		if err := setValue(elem, value); err != nil {
+			return nil, err
+		}
+
+		prop.Default = schemaValue(elem)
+	}
+
+	for tag := field.Tag.Get(ValidateTag); tag != ""; {
+		var rule string
+
+		rule, tag, _ = strings.Cut(tag, ",")
+		if rule = strings.TrimSpace(rule); strings.HasPrefix(rule, "regexp=") && tag != "" {
+			rule, tag = rule+","+tag, "" // Regular expressions may contain commas.
+		}
+
+		if rule == "required" {
+			parent.Required = append(parent.Required, key)
+		} else if err := prop.addRule(field.Type, rule); err != nil {
+			return nil, err
+		}
+	}
+
+	return prop, nil
+}
+
+// addRule converts a validate tag rule into a keyword. See checkRule for the rules.
+func (s *Schema) addRule(typ reflect.Type, rule string) error {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	rule, arg, _ := strings.Cut(rule, "=")
+
+	switch rule {
+	case "min", "max":
+		return s.addLimit(typ, rule, arg)
+	case "oneof":
+		for _, value := range strings.Fields(arg) {
+			elem := reflect.New(typ).Elem()
+			if err := setValue(elem, value); err != nil {
+				return fmt.Errorf("%w: oneof=%s: %w", ErrInvalidRule, arg, err)
+			}
+
+			s.Enum = append(s.Enum, schemaValue(elem))
+		}
+	case "regexp":
+		if _, err := regexp.Compile(arg); err != nil {
+			return fmt.Errorf("%w: regexp: %w", ErrInvalidRule, err)
+		}
+
+		s.Pattern = arg
+	case "", "file_exists":
+	default:
+		return fmt.Errorf("%w: unknown rule '%s'", ErrInvalidRule, rule)
+	}
+
+	return nil
+}
+
+// addLimit converts a min or max rule into the keyword for the type: a number, a length, or a count.
+// Durations and byte sizes may be strings, so their limits are not converted.
+func (s *Schema) addLimit(typ reflect.Type, rule, arg string) error {
+	if len(s.Type) > 0 && s.Type[0] == schemaString && typ.Kind() != reflect.String {
+		return nil
+	}
+
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return fmt.Errorf("%w: %s=%s: %w", ErrInvalidRule, rule, arg, err)
+	}
+
+	minimum := rule == "min"
+
+	switch typ.Kind() { //nolint:exhaustive // Everything else is a number.
+	case reflect.String:
+		setLimit(minimum, &s.MinLength, &s.MaxLength, int(limit))
+	case reflect.Slice, reflect.Array:
+		setLimit(minimum, &s.MinItems, &s.MaxItems, int(limit))
+	case reflect.Map:
+		setLimit(minimum, &s.MinProperties, &s.MaxProperties, int(limit))
+	default:
+		setLimit(minimum, &s.Minimum, &s.Maximum, limit)
+	}
+
+	return nil
+}
+
+// setLimit sets the minimum or the maximum keyword.
+func setLimit[V int | float64](minimum bool, minKeyword, maxKeyword **V, limit V) {
+	if minimum {
+		*minKeyword = &limit
+	} else {
+		*maxKeyword = &limit
+	}
+}
+
+// schemaValue converts a value into a JSON value for a default or an enum.
+// Strings, durations and anything that marshals to text is a string.
+func schemaValue(elem reflect.Value) interface{} {
+	for elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+
+	if elem.Kind() == reflect.String {
+		return elem.String() // Do not redact a Secret.
+	}
+
+	if dur, ok := elem.Interface().(time.Duration); ok {
+		return dur.String()
+	}
+
+	if marshaler, ok := elem.Interface().(encoding.TextMarshaler); ok {
+		if text, err := marshaler.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+
+	if elem.Kind() == reflect.Slice || elem.Kind() == reflect.Array {
+		list := make([]interface{}, elem.Len())
+		for idx := range list {
+			list[idx] = schemaValue(elem.Index(idx))
+		}
+
+		return list
+	}
+
+	return elem.Interface()
+}
+
+// ValidateFiles loads and merges config files exactly like UnmarshalTree, and validates the result.
+// Use this to check config files before you unmarshal them.
+func (s *Schema) ValidateFiles(opts *UnmarshalOpts, configFile ...string) error {
+	tree := map[string]interface{}{}
+	if _, err := UnmarshalTree(tree, opts, configFile...); err != nil {
+		return err
+	}
+
+	return s.Validate(tree)
+}
+
+// Validate checks a generic tree, like the one from UnmarshalTree, against the schema.
+// Every violation is returned at once in a ValidationError. The element names are the keys in the tree,
+// prefixed with Config, ie. Config.server.listen. Types are checked strictly, so this works best with
+// JSON, YAML and TOML. XML values are strings, unless they look like a number or a boolean.
+func (s *Schema) Validate(tree interface{}) error {
+	valid := &validator{parser: (&Opts{}).newParser()}
+	valid.checkSchema(s, s, tree, valid.Name)
+
+	if len(valid.Errors) > 0 {
+		return &ValidationError{Errors: valid.Errors}
+	}
+
+	return nil
+}
+
+// checkSchema checks a value against a schema, and recurses into objects and arrays.
+func (v *validator) checkSchema(root, schema *Schema, value interface{}, name string) {
+	v.CurrentDepth++
+	defer func() { v.CurrentDepth-- }()
+
+	if v.CurrentDepth > v.MaxDepth {
+		return
+	}
+
+	if schema = root.resolve(schema); schema == nil {
+		v.addError(name, "", fmt.Errorf("%w: unknown $ref", ErrInvalidRule))
+		return
+	}
+
+	if !schema.Type.allows(value) {
+		v.addError(name, "", fmt.Errorf("%w: expected %s, got %s", ErrWrongType,
+			strings.Join(schema.Type, " or "), jsonType(value)))
+
+		return
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		v.addError(name, "", fmt.Errorf("%w: %v", ErrNotOneOf, schema.Enum))
+	}
+
+	switch val := value.(type) {
+	case string:
+		v.checkString(schema, val, name)
+	case []interface{}:
+		v.checkLength(schema.MinItems, schema.MaxItems, len(val), name)
+
+		if schema.Items != nil {
+			for idx, item := range val {
+				v.checkSchema(root, schema.Items, item, fmt.Sprintf("%s[%d/%d]", name, idx+1, len(val)))
+			}
+		}
+	case map[string]interface{}:
+		v.checkObject(root, schema, val, name)
+	default:
+		if number, ok := toFloat(value); ok {
+			v.checkNumber(schema, number, name)
+		}
+	}
+}
+
+// resolve returns the schema a $ref points to. Only references to the root and to $defs are supported.
+func (s *Schema) resolve(schema *Schema) *Schema {
+	switch ref := schema.Ref; {
+	case ref == "":
+		return schema
+	case ref == "#":
+		return s
+	case strings.HasPrefix(ref, schemaDefsRef):
+		return s.Defs[strings.TrimPrefix(ref, schemaDefsRef)]
+	default:
+		return nil
+	}
+}
+
+// checkString checks the length and pattern of a string.
+func (v *validator) checkString(schema *Schema, value, name string) {
+	v.checkLength(schema.MinLength, schema.MaxLength, utf8.RuneCountInString(value), name)
+
+	if schema.Pattern == "" {
+		return
+	}
+
+	if expr, err := regexp.Compile(schema.Pattern); err != nil {
+		v.addError(name, "", fmt.Errorf("%w: pattern: %w", ErrInvalidRule, err))
+	} else if !expr.MatchString(value) {
+		v.addError(name, "", fmt.Errorf("%w: %s", ErrNoMatch, schema.Pattern))
+	}
+}
+
+// checkNumber checks the minimum and maximum of a number.
+func (v *validator) checkNumber(schema *Schema, value float64, name string) {
+	if schema.Minimum != nil && value < *schema.Minimum {
+		v.addError(name, "", fmt.Errorf("%w: %v", ErrBelowMin, *schema.Minimum))
+	}
+
+	if schema.Maximum != nil && value > *schema.Maximum {
+		v.addError(name, "", fmt.Errorf("%w: %v", ErrAboveMax, *schema.Maximum))
+	}
+}
+
+// checkLength checks the length of a string, or the number of items or properties.
+func (v *validator) checkLength(minimum, maximum *int, length int, name string) {
+	if minimum != nil && length < *minimum {
+		v.addError(name, "", fmt.Errorf("%w: length %d", ErrBelowMin, *minimum))
+	}
+
+	if maximum != nil && length > *maximum {
+		v.addError(name, "", fmt.Errorf("%w: length %d", ErrAboveMax, *maximum))
+	}
+}
+
+// checkObject checks the required keys of an object, and checks every value in it.
+func (v *validator) checkObject(root, schema *Schema, value map[string]interface{}, name string) {
+	v.checkLength(schema.MinProperties, schema.MaxProperties, len(value), name)
+
+	for _, key := range schema.Required {
+		if _, ok := value[key]; !ok {
+			v.addError(name+"."+key, "", ErrRequired)
+		}
+	}
+
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if prop, ok := schema.Properties[key]; ok {
+			v.checkSchema(root, prop, value[key], name+"."+key)
+			continue
+		}
+
+		switch additional := schema.AdditionalProperties.(type) {
+		case bool:
+			if !additional {
+				v.addError(name+"."+key, "", ErrUnknownKey)
+			}
+		case *Schema:
+			v.checkSchema(root, additional, value[key], fmt.Sprint(name, "[", key, "]"))
+		}
+	}
+}
+
+// allows returns true if a value has one of the types. No types allows every value.
+// A whole number is an integer, even if it's a float.
+func (s SchemaType) allows(value interface{}) bool {
+	if len(s) == 0 {
+		return true
+	}
+
+	valueType := jsonType(value)
+	number, _ := toFloat(value)
+
+	for _, typ := range s {
+		switch {
+		case typ == valueType,
+			typ == schemaNumber && valueType == schemaInt,
+			typ == schemaInt && valueType == schemaNumber && number == math.Trunc(number):
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonType returns the JSON Schema type of a value from a generic tree.
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return schemaNull
+	case bool:
+		return schemaBool
+	case string, time.Time:
+		return schemaString
+	case []interface{}:
+		return schemaArray
+	case map[string]interface{}:
+		return schemaObject
+	}
+
+	switch reflect.ValueOf(value).Kind() { //nolint:exhaustive // Anything else is unexpected.
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return schemaInt
+	case reflect.Float32, reflect.Float64:
+		return schemaNumber
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// toFloat converts any number into a float64.
+func toFloat(value interface{}) (float64, bool) {
+	elem := reflect.ValueOf(value)
+
+	switch {
+	case !elem.IsValid():
+		return 0, false
+	case elem.CanInt():
+		return float64(elem.Int()), true
+	case elem.CanUint():
+		return float64(elem.Uint()), true
+	case elem.CanFloat():
+		return elem.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// inEnum returns true if a value is in a list. Numbers are compared by value.
+func inEnum(enum []interface{}, value interface{}) bool {
+	number, isNumber := toFloat(value)
+
+	for _, allowed := range enum {
+		if other, ok := toFloat(allowed); ok && isNumber && other == number {
+			return true
+		}
+
+		if fmt.Sprint(allowed) == fmt.Sprint(value) {
+			return true
+		}
+	}
+
+	return false
+}
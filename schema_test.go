@@ -0,0 +1,141 @@
+package cnfgfile_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+type schemaStruct struct {
+	Listen   string               `json:"listen" yaml:"listen" validate:"required" desc:"Address to listen on."`
+	Level    string               `json:"level" yaml:"level" validate:"oneof=debug info" default:"info"`
+	Port     uint16               `json:"port" yaml:"port" validate:"min=1" default:"8080"`
+	Ratio    *float64             `json:"ratio,omitempty" yaml:"ratio" validate:"max=1"`
+	Timeout  cnfgfile.Duration    `json:"timeout" yaml:"timeout" default:"1m" validate:"min=1s"`
+	Wait     time.Duration        `json:"wait" yaml:"wait"`
+	Size     cnfgfile.ByteSize    `json:"size" yaml:"size"`
+	Password cnfgfile.Secret      `json:"password" yaml:"password" default:"filepath:/pass"`
+	Tags     []string             `json:"tags" yaml:"tags" default:"a,b" validate:"max=2"`
+	Host     string               `json:"host" yaml:"host" validate:"regexp=^[a-z]+$"`
+	Skip     string               `json:"-" yaml:"-"`
+	Plain    int                  // No tag, so json uses Plain and yaml uses plain.
+	Sub      *schemaSub           `json:"sub" yaml:"sub"`
+	Subs     map[string]schemaSub `json:"subs" yaml:"subs"`
+	schemaEmbed
+}
+
+type schemaSub struct {
+	Name string     `json:"name" yaml:"name"`
+	Next *schemaSub `json:"next" yaml:"next"`
+}
+
+type schemaEmbed struct {
+	Embedded bool `json:"embedded" yaml:"embedded"`
+}
+
+func TestNewSchema(t *testing.T) {
+	t.Parallel()
+
+	schema, err := cnfgfile.NewSchema(&schemaStruct{}, "")
+	require.NoError(t, err)
+
+	data, err := json.Marshal(schema)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title": "schemaStruct",
+		"type": "object",
+		"additionalProperties": false,
+		"required": ["listen"],
+		"properties": {
+			"listen": {"type": "string", "description": "Address to listen on."},
+			"level": {"type": "string", "default": "info", "enum": ["debug", "info"]},
+			"port": {"type": "integer", "default": 8080, "minimum": 1},
+			"ratio": {"type": ["number", "null"], "maximum": 1},
+			"timeout": {"type": ["string", "number"], "default": "1m"},
+			"wait": {"type": ["string", "number"]},
+			"size": {"type": ["string", "number"]},
+			"password": {"type": "string", "default": "filepath:/pass"},
+			"tags": {"type": "array", "items": {"type": "string"}, "default": ["a", "b"], "maxItems": 2},
+			"host": {"type": "string", "pattern": "^[a-z]+$"},
+			"Plain": {"type": "integer"},
+			"sub": {"$ref": "#/$defs/schemaSub"},
+			"subs": {"type": "object", "additionalProperties": {"$ref": "#/$defs/schemaSub"}},
+			"embedded": {"type": "boolean"}
+		},
+		"$defs": {
+			"schemaSub": {
+				"type": "object",
+				"additionalProperties": false,
+				"properties": {
+					"name": {"type": "string"},
+					"next": {"$ref": "#/$defs/schemaSub"}
+				}
+			}
+		}
+	}`, string(data))
+
+	schema, err = cnfgfile.NewSchema(schemaStruct{}, cnfgfile.FormatYAML)
+	require.NoError(t, err)
+	assert.Contains(t, schema.Properties, "plain", "yaml lowercases names without a tag")
+	assert.NotContains(t, schema.Properties, "embedded", "yaml does not inline without the inline option")
+	assert.NotContains(t, schema.Properties, "schemaembed", "yaml skips unexported members")
+
+	_, err = cnfgfile.NewSchema("string", "")
+	require.ErrorIs(t, err, cnfgfile.ErrNotStruct)
+
+	_, err = cnfgfile.NewSchema(struct {
+		Port int `validate:"min=one"`
+	}{}, "")
+	require.ErrorIs(t, err, cnfgfile.ErrInvalidRule)
+
+	_, err = cnfgfile.NewSchema(struct {
+		Port int `default:"one"`
+	}{}, "")
+	require.Error(t, err)
+}
+
+func TestSchemaValidate(t *testing.T) {
+	t.Parallel()
+
+	schema, err := cnfgfile.NewSchema(&schemaStruct{}, cnfgfile.FormatYAML)
+	require.NoError(t, err)
+
+	valid := writeFile(t, "valid.yaml", []byte("listen: :80\nlevel: debug\nport: 80\nratio: 0.5\ntimeout: 1m\n"+
+		"wait: 5\ntags: [a]\nhost: abc\nsub:\n  name: x\n  next:\n    name: y\nsubs:\n  a:\n    name: z\n"))
+	require.NoError(t, schema.ValidateFiles(nil, valid))
+
+	invalid := writeFile(t, "invalid.json", []byte(`{"level": "trace", "port": 0, "ratio": 2, "timeout": true,
+		"tags": ["a", "b", "c"], "host": "ABC", "typo": 1, "sub": {"next": {"name": 1}}, "subs": {"a": {"x": 1}}}`))
+	err = schema.ValidateFiles(nil, invalid)
+	require.Error(t, err)
+
+	var validErr *cnfgfile.ValidationError
+	require.ErrorAs(t, err, &validErr)
+
+	failed := map[string]error{}
+	for _, elemErr := range validErr.Errors {
+		failed[elemErr.Name] = elemErr.Inner
+	}
+
+	assert.ErrorIs(t, failed["Config.listen"], cnfgfile.ErrRequired)
+	assert.ErrorIs(t, failed["Config.level"], cnfgfile.ErrNotOneOf)
+	assert.ErrorIs(t, failed["Config.port"], cnfgfile.ErrBelowMin)
+	assert.ErrorIs(t, failed["Config.ratio"], cnfgfile.ErrAboveMax)
+	assert.ErrorIs(t, failed["Config.timeout"], cnfgfile.ErrWrongType)
+	assert.ErrorIs(t, failed["Config.tags"], cnfgfile.ErrAboveMax)
+	assert.ErrorIs(t, failed["Config.host"], cnfgfile.ErrNoMatch)
+	assert.ErrorIs(t, failed["Config.typo"], cnfgfile.ErrUnknownKey)
+	assert.ErrorIs(t, failed["Config.sub.next.name"], cnfgfile.ErrWrongType)
+	assert.ErrorIs(t, failed["Config.subs[a].x"], cnfgfile.ErrUnknownKey)
+	assert.Len(t, validErr.Errors, 10)
+
+	require.NoError(t, schema.Validate(map[string]interface{}{"listen": "x", "ratio": nil, "port": 1.0}),
+		"null is allowed for pointers, and a whole float is an integer")
+	require.ErrorIs(t, schema.Validate(map[string]interface{}{"listen": "x", "port": 1.5}), cnfgfile.ErrWrongType)
+	require.Error(t, schema.ValidateFiles(nil, "/no_file.json"))
+}
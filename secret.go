@@ -0,0 +1,92 @@
+package cnfgfile
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// SecretRedacted is printed, logged and marshaled in place of a Secret's value.
+const SecretRedacted = "[REDACTED]"
+
+// Secret is a string that redacts itself when it's printed, logged or marshaled.
+// Use it for passwords, tokens and other values you do not want to leak into logs or dumps.
+// Parse() fills a Secret like any other string, so `filepath:` references work.
+// Empty secrets remain empty so you can see they are not set. Call Reveal() to get the value.
+type Secret string
+
+// Reveal returns the real value of the secret.
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// redact returns the redaction marker, or an empty string if the secret is empty.
+func (s Secret) redact() string {
+	if s == "" {
+		return ""
+	}
+
+	return SecretRedacted
+}
+
+// String returns the redaction marker instead of the secret value.
+func (s Secret) String() string {
+	return s.redact()
+}
+
+// GoString returns the redaction marker instead of the secret value. Used by %#v.
+func (s Secret) GoString() string {
+	return strconv.Quote(s.redact())
+}
+
+// Format makes every fmt verb print the redaction marker, including verbs that are not valid for strings.
+func (s Secret) Format(state fmt.State, verb rune) {
+	switch verb {
+	case 'q':
+		fmt.Fprint(state, strconv.Quote(s.redact()))
+	case 'v':
+		if state.Flag('#') {
+			fmt.Fprint(state, s.GoString())
+			return
+		}
+
+		fallthrough
+	default:
+		fmt.Fprint(state, s.redact())
+	}
+}
+
+// MarshalText returns the redaction marker. This is used by the TOML, YAML and XML encoders.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.redact()), nil
+}
+
+// MarshalJSON returns the redaction marker as a JSON string.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(s.redact())), nil
+}
+
+// MarshalYAML returns the redaction marker.
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.redact(), nil
+}
+
+// LogValue returns the redaction marker for structured (slog) logging.
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.redact())
+}
+
+// Make sure our type satisfies the interfaces it's for.
+var (
+	_ encoding.TextMarshaler = (*Secret)(nil)
+	_ json.Marshaler         = (*Secret)(nil)
+	_ yaml.Marshaler         = (*Secret)(nil)
+	_ slog.LogValuer         = (*Secret)(nil)
+	_ fmt.Stringer           = (*Secret)(nil)
+	_ fmt.GoStringer         = (*Secret)(nil)
+	_ fmt.Formatter          = (*Secret)(nil)
+)
@@ -0,0 +1,72 @@
+package cnfgfile_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+type secretStruct struct {
+	XMLName  xml.Name        `json:"-"        toml:"-"        xml:"config"   yaml:"-"`
+	Password cnfgfile.Secret `json:"password" toml:"password" xml:"password" yaml:"password"`
+	Empty    cnfgfile.Secret `json:"empty"    toml:"empty"    xml:"empty"    yaml:"empty"`
+}
+
+func TestSecret(t *testing.T) {
+	t.Parallel()
+
+	secret := cnfgfile.Secret("hunter2")
+
+	assert.Equal(t, "hunter2", secret.Reveal())
+
+	for _, format := range []string{"%v", "%s", "%q", "%#v", "%+v", "%x", "%d", "%10s"} {
+		assert.NotContains(t, fmt.Sprintf(format, secret), "hunter2", format)
+		assert.Contains(t, fmt.Sprintf(format, secret), cnfgfile.SecretRedacted, format)
+	}
+
+	assert.NotContains(t, fmt.Sprintf("%+v", secretStruct{Password: secret}), "hunter2")
+	assert.Equal(t, `""`, fmt.Sprintf("%q", cnfgfile.Secret("")), "empty secrets must remain empty")
+
+	buf := bytes.Buffer{}
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("test", "password", secret)
+	assert.NotContains(t, buf.String(), "hunter2")
+	assert.Contains(t, buf.String(), cnfgfile.SecretRedacted)
+
+	for _, name := range []string{"json", "toml", "yaml", "xml"} {
+		buf := bytes.Buffer{}
+		require.NoError(t, marshalFormat(name, &buf, secretStruct{Password: secret}), name)
+		assert.NotContains(t, buf.String(), "hunter2", name)
+		assert.Contains(t, buf.String(), cnfgfile.SecretRedacted, name)
+
+		output := secretStruct{}
+		require.NoError(t, unmarshalFormat(name, []byte(secretInput[name]), &output), name)
+		assert.Equal(t, "hunter2", output.Password.Reveal(), name)
+	}
+}
+
+var secretInput = map[string]string{ //nolint:gochecknoglobals
+	"json": `{"password": "hunter2"}`,
+	"toml": `password = "hunter2"`,
+	"yaml": `password: hunter2`,
+	"xml":  `<config><password>hunter2</password></config>`,
+}
+
+func TestSecretParse(t *testing.T) {
+	t.Parallel()
+
+	file := makeTextFile(t)
+	defer os.Remove(file)
+
+	data := &secretStruct{Password: cnfgfile.Secret(cnfgfile.DefaultPrefix + file)}
+	output, err := cnfgfile.Parse(data, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hi, this is a string", data.Password.Reveal())
+	assert.Equal(t, file, output["Config.Password"])
+}
@@ -0,0 +1,170 @@
+package cnfgfile
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Errors returned when a selector cannot be used.
+var (
+	ErrSelectorNotFound = errors.New("selector not found in file")
+	ErrNoSelectFormat   = errors.New("selectors are not supported for this file format")
+	ErrSelectSize       = errors.New("file with a selector is larger than SelectMaxSize")
+)
+
+// formatDotenv is only used for selecting values from files.
+const formatDotenv = "dotenv"
+
+// readReference reads the file a reference points to.
+// If the reference has a selector, the selected value is returned instead of the whole file.
+// A file with a selector is read up to SelectMaxSize, because it cannot be decoded if it's truncated.
+func (p *parser) readReference(reference, encoding string) (string, error) {
+	filePath, selector := p.splitSelector(reference)
+	if selector == "" {
+		return p.readFile(p.TransformPath(filePath), encoding)
+	}
+
+	content, err := p.readContent(p.TransformPath(filePath), encoding, p.SelectMaxSize)
+	if err != nil {
+		return "", err
+	} else if content.truncated {
+		return "", fmt.Errorf("%w: %d bytes", ErrSelectSize, p.SelectMaxSize)
+	}
+
+	return selectValue(string(content.data), filePath, selector)
+}
+
+// splitSelector splits a reference into a file path and a selector, ie. /run/secrets/db.json#/password.
+// If the whole reference is the path to an existing file, it is not split.
+func (p *parser) splitSelector(reference string) (string, string) {
+	idx := strings.LastIndex(reference, "#")
+	if idx < 0 {
+		return reference, ""
+	}
+
+	if p.exists(reference) {
+		return reference, "" // The file name contains a #.
+	}
+
+	return reference[:idx], reference[idx+1:]
+}
+
+// selectValue decodes a file's content using the format of its name, and returns the value at the selector.
+func selectValue(content, filePath, selector string) (string, error) {
+	format := selectFormatOf(filePath)
+	if format == formatDotenv {
+		return selectDotenv(content, selector)
+	}
+
+	tree, err := decodeTree(strings.NewReader(content), filePath, format)
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasPrefix(selector, "/") {
+		selector = "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(selector)
+	}
+
+	// TOML arrays of tables are []map[string]interface{}; make them lists like every other format.
+	value, err := selectPointer(normalizeTree(tree), selector)
+	if err != nil {
+		return "", err
+	}
+
+	return selectedString(value)
+}
+
+// selectFormatOf returns the format of a file to select a value from.
+// Works like formatOf, but also recognizes dotenv files, ie. .env, app.env and .env.local.
+func selectFormatOf(filePath string) string {
+	base := strings.ToLower(filepath.Base(filePath))
+	if base == ".env" || strings.HasSuffix(base, ".env") || strings.HasPrefix(base, ".env.") {
+		return formatDotenv
+	}
+
+	return FormatOf(filePath)
+}
+
+// selectPointer follows a JSON pointer (RFC 6901) through a decoded file.
+func selectPointer(tree interface{}, pointer string) (interface{}, error) {
+	for _, token := range strings.Split(pointer, "/")[1:] {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+
+		switch node := tree.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrSelectorNotFound, pointer)
+			}
+
+			tree = value
+		case []interface{}:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, fmt.Errorf("%w: %s", ErrSelectorNotFound, pointer)
+			}
+
+			tree = node[idx]
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrSelectorNotFound, pointer)
+		}
+	}
+
+	return tree, nil
+}
+
+// selectedString converts a selected value into a string. Objects and arrays are returned as JSON.
+func selectedString(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case nil:
+		return "", nil
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("encoding selected value: %w", err)
+		}
+
+		return string(data), nil
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
+
+// selectDotenv returns the value of a key in a dotenv file. Supports comments, quotes, and export.
+func selectDotenv(content, key string) (string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, found := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !found || strings.TrimSpace(name) != key {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil && strings.HasPrefix(value, `"`) {
+			return unquoted, nil
+		} else if len(value) > 1 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
+			return value[1 : len(value)-1], nil
+		}
+
+		// Remove inline comments from unquoted values.
+		if idx := strings.Index(value, " #"); idx >= 0 {
+			value = strings.TrimSpace(value[:idx])
+		}
+
+		return value, nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrSelectorNotFound, key)
+}
@@ -0,0 +1,117 @@
+package cnfgfile_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+func TestParseSelector(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"db.json":     `{"username": "admin", "password": "hunter2", "port": 5432, "a/b": "slash", "hosts": ["one", "two"]}`,
+		"db.yaml":     "database:\n  password: yamlpass\n  ports: [1, 2]\n",
+		"db.toml":     "[database]\npassword = \"tomlpass\"\n[[servers]]\npassword = \"serverpass\"\n",
+		"secrets.env": "# comment\nexport DB_USER=admin\nDB_PASS=\"quoted pass\"\nDB_NAME='single' \nDB_HOST=host # inline\n",
+		"hash#file":   "hashed",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600))
+	}
+
+	data := &struct {
+		User    string
+		Pass    string
+		PortStr string
+		Slash   string
+		Host    string
+		Hosts   string
+		YAML    string
+		YAMLInt string
+		TOML    string
+		TOMLArr string
+		EnvUser string
+		EnvPass string
+		EnvName string
+		EnvHost string
+		Hash    string
+	}{
+		User:    cnfgfile.DefaultPrefix + filepath.Join(dir, "db.json#username"),
+		Pass:    cnfgfile.DefaultPrefix + filepath.Join(dir, "db.json#/password"),
+		PortStr: cnfgfile.DefaultPrefix + filepath.Join(dir, "db.json#/port"),
+		Slash:   cnfgfile.DefaultPrefix + filepath.Join(dir, "db.json#/a~1b"),
+		Host:    cnfgfile.DefaultPrefix + filepath.Join(dir, "db.json#/hosts/1"),
+		Hosts:   cnfgfile.DefaultPrefix + filepath.Join(dir, "db.json#hosts"),
+		YAML:    cnfgfile.DefaultPrefix + filepath.Join(dir, "db.yaml#/database/password"),
+		YAMLInt: cnfgfile.DefaultPrefix + filepath.Join(dir, "db.yaml#/database/ports/0"),
+		TOML:    cnfgfile.DefaultPrefix + filepath.Join(dir, "db.toml#/database/password"),
+		TOMLArr: cnfgfile.DefaultPrefix + filepath.Join(dir, "db.toml#/servers/0/password"),
+		EnvUser: cnfgfile.DefaultPrefix + filepath.Join(dir, "secrets.env#DB_USER"),
+		EnvPass: cnfgfile.DefaultPrefix + filepath.Join(dir, "secrets.env#DB_PASS"),
+		EnvName: cnfgfile.DefaultPrefix + filepath.Join(dir, "secrets.env#DB_NAME"),
+		EnvHost: cnfgfile.DefaultPrefix + filepath.Join(dir, "secrets.env#DB_HOST"),
+		Hash:    cnfgfile.DefaultPrefix + filepath.Join(dir, "hash#file"),
+	}
+
+	output, err := cnfgfile.Parse(data, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "admin", data.User)
+	assert.Equal(t, "hunter2", data.Pass)
+	assert.Equal(t, "5432", data.PortStr)
+	assert.Equal(t, "slash", data.Slash)
+	assert.Equal(t, "two", data.Host)
+	assert.Equal(t, `["one","two"]`, data.Hosts)
+	assert.Equal(t, "yamlpass", data.YAML)
+	assert.Equal(t, "1", data.YAMLInt)
+	assert.Equal(t, "tomlpass", data.TOML)
+	assert.Equal(t, "serverpass", data.TOMLArr, "toml arrays of tables must be selected like lists")
+	assert.Equal(t, "admin", data.EnvUser)
+	assert.Equal(t, "quoted pass", data.EnvPass)
+	assert.Equal(t, "single", data.EnvName)
+	assert.Equal(t, "host", data.EnvHost)
+	assert.Equal(t, "hashed", data.Hash, "files with a # in the name must be read")
+	assert.Equal(t, filepath.Join(dir, "db.json#/password"), output["Config.Pass"])
+}
+
+func TestParseSelectorErrors(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "db.json"), []byte(`{"list": [1]}`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "db.xml"), []byte(`<xml></xml>`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".env"), []byte(`KEY=value`), 0o600))
+
+	for _, selector := range []string{"db.json#/nope", "db.json#/list/1", "db.json#/list/x/y", ".env#NOPE"} {
+		data := &struct{ Name string }{Name: cnfgfile.DefaultPrefix + filepath.Join(dir, selector)}
+		_, err := cnfgfile.Parse(data, nil)
+		require.ErrorIs(t, err, cnfgfile.ErrSelectorNotFound, selector)
+		require.ErrorContains(t, err, "element failure: Config.Name", selector)
+	}
+
+	data := &struct{ Name string }{Name: cnfgfile.DefaultPrefix + filepath.Join(dir, "db.xml#/xml")}
+	_, err := cnfgfile.Parse(data, nil)
+	require.ErrorIs(t, err, cnfgfile.ErrNoSelectFormat)
+}
+
+func TestParseSelectorMaxSize(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "db.json")
+	padding := strings.Repeat("x", 2000)
+	require.NoError(t, os.WriteFile(file, []byte(`{"pad": "`+padding+`", "password": "hunter2"}`), 0o600))
+
+	data := &struct{ Name string }{Name: cnfgfile.DefaultPrefix + file + "#password"}
+	_, err := cnfgfile.Parse(data, nil)
+	require.NoError(t, err, "files with a selector must not be truncated to MaxSize")
+	assert.Equal(t, "hunter2", data.Name)
+
+	data.Name = cnfgfile.DefaultPrefix + file + "#password"
+	_, err = cnfgfile.Parse(data, &cnfgfile.Opts{SelectMaxSize: 100})
+	require.ErrorIs(t, err, cnfgfile.ErrSelectSize)
+}
@@ -0,0 +1,489 @@
+package cnfgfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	toml "github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Errors returned by UnmarshalTree when a config file is not strictly valid.
+var (
+	ErrDuplicateKey = errors.New("duplicate key")
+	ErrTrailingData = errors.New("unexpected data after the top level value")
+)
+
+// ErrXMLName is returned by EncodeTree when a map key cannot be used as an XML element name.
+var ErrXMLName = errors.New("invalid XML element name")
+
+// xmlRoot is the name of the root element EncodeTree uses for XML output.
+const xmlRoot = "config"
+
+// SyntaxError is returned by UnmarshalTree when a config file cannot be decoded.
+// The line and column are 0 when they are not known.
+type SyntaxError struct {
+	// File is the name of the config file (or URL).
+	File string
+	// Line and Column are where the error was found. Both start at 1.
+	Line   int
+	Column int
+	// Inner is the error from the decoder.
+	Inner error
+}
+
+// Error satisfies the standard Go library error interface. The format is file:line:column: error.
+func (s *SyntaxError) Error() string {
+	switch {
+	case s.Line == 0:
+		return s.File + ": " + s.Inner.Error()
+	case s.Column == 0:
+		return fmt.Sprintf("%s:%d: %v", s.File, s.Line, s.Inner)
+	default:
+		return fmt.Sprintf("%s:%d:%d: %v", s.File, s.Line, s.Column, s.Inner)
+	}
+}
+
+// Unwrap is used to make the custom error work with errors.Is and errors.As.
+func (s *SyntaxError) Unwrap() error {
+	return s.Inner
+}
+
+// UnmarshalTree works like UnmarshalWith, but it decodes config files into a generic tree of maps, slices and
+// values instead of a struct. Every file is merged into the tree: maps are merged, and other values are replaced.
+// Use this to inspect or convert config files without a config struct. The decoding is strict: a map with the
+// same key twice is an error in every format. Errors that happen while decoding are a *SyntaxError with the
+// line (and column) of the error, if the decoder provides it. XML elements become maps; the root element
+// is removed, repeated elements become slices, and attributes become keys. XML values are strings,
+// except for numbers and booleans that are written exactly as Go formats them, ie. 123 and true.
+func UnmarshalTree(tree map[string]interface{}, opts *UnmarshalOpts, configFile ...string) ([]string, error) {
+	if tree == nil {
+		return nil, ErrNotPtr
+	} else if len(configFile) == 0 {
+		return nil, ErrNoFile
+	}
+
+	unmarshaler := opts.newUnmarshaler()
+
+	return unmarshaler.each(configFile, func(fileName string) error {
+		return unmarshaler.load(fileName, func(reader io.Reader, format string) error {
+			decoded, err := decodeStrict(reader, fileName, format)
+			if err == nil {
+				mergeTree(tree, decoded)
+			}
+
+			return err
+		})
+	})
+}
+
+// EncodeTree encodes a generic tree, like the one from UnmarshalTree, into a file format.
+// XML output has a root element named config, and map keys are sorted in every format.
+// Map keys must be valid XML element names for XML output; ErrXMLName is returned otherwise.
+func EncodeTree(tree interface{}, format string) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		err error
+	)
+
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(&buf)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(tree)
+	case FormatYAML:
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2) //nolint:mnd
+		err = encoder.Encode(tree)
+	case FormatTOML:
+		err = toml.NewEncoder(&buf).Encode(tree)
+	case FormatXML:
+		err = encodeXML(&buf, xmlRoot, tree, 0)
+	default:
+		err = fmt.Errorf("%w: %s", ErrNoSelectFormat, format)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s: %w", format, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// mergeTree merges a tree into another. Maps are merged recursively, other values are replaced.
+func mergeTree(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, srcOK := value.(map[string]interface{})
+		if dstMap, dstOK := dst[key].(map[string]interface{}); srcOK && dstOK {
+			mergeTree(dstMap, srcMap)
+			continue
+		}
+
+		dst[key] = value
+	}
+}
+
+// decodeStrict decodes a config file into a generic tree, and returns a *SyntaxError if that fails.
+func decodeStrict(reader io.Reader, fileName, format string) (map[string]interface{}, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading file %s: %w", fileName, err)
+	}
+
+	var (
+		tree   interface{}
+		offset int64 = -1
+	)
+
+	switch format {
+	case FormatJSON:
+		tree, offset, err = decodeJSONTree(data)
+	case FormatXML:
+		tree, offset, err = decodeXMLTree(data)
+	case FormatYAML:
+		err = yaml.Unmarshal(data, &tree)
+	default:
+		tomlTree := map[string]interface{}{}
+		_, err = toml.Decode(string(data), &tomlTree)
+		tree = tomlTree
+	}
+
+	if err != nil {
+		return nil, syntaxError(fileName, data, offset, err)
+	}
+
+	switch top := normalizeTree(tree).(type) {
+	case map[string]interface{}:
+		return top, nil
+	case nil:
+		return map[string]interface{}{}, nil // Empty file.
+	default:
+		inner := fmt.Errorf("%w: top level must be a map, not %T", ErrUnsupportedType, top)
+		return nil, &SyntaxError{File: fileName, Line: 0, Column: 0, Inner: inner}
+	}
+}
+
+// yamlLine finds the line number in a yaml error message.
+var yamlLine = regexp.MustCompile(`line (\d+)`)
+
+// syntaxError wraps a decoder error with its position. The offset is used if the error does not have a position.
+func syntaxError(fileName string, data []byte, offset int64, err error) error {
+	var (
+		jsonErr *json.SyntaxError
+		xmlErr  *xml.SyntaxError
+		tomlErr toml.ParseError
+		output  = &SyntaxError{File: fileName, Inner: err}
+	)
+
+	switch {
+	case errors.As(err, &jsonErr):
+		// The offset is before any whitespace that precedes the invalid character.
+		for offset = jsonErr.Offset; offset < int64(len(data)) && bytes.ContainsRune([]byte(" \t\r\n"), rune(data[offset])); {
+			offset++
+		}
+	case errors.As(err, &tomlErr):
+		offset = int64(tomlErr.Position.Start)
+	case errors.As(err, &xmlErr):
+		output.Line = xmlErr.Line
+	default:
+		if match := yamlLine.FindStringSubmatch(err.Error()); match != nil && offset < 0 {
+			output.Line, _ = strconv.Atoi(match[1])
+		}
+	}
+
+	if offset >= 0 && output.Line == 0 {
+		output.Line, output.Column = position(data, offset)
+	}
+
+	return output
+}
+
+// position converts a byte offset into a line and column.
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+
+	return line, column
+}
+
+// normalizeTree converts the maps and slices the decoders create into map[string]interface{} and []interface{}.
+func normalizeTree(node interface{}) interface{} {
+	switch val := node.(type) {
+	case map[string]interface{}:
+		for key, value := range val {
+			val[key] = normalizeTree(value)
+		}
+
+		return val
+	case map[interface{}]interface{}:
+		output := make(map[string]interface{}, len(val))
+		for key, value := range val {
+			output[fmt.Sprint(key)] = normalizeTree(value)
+		}
+
+		return output
+	case []interface{}:
+		for idx := range val {
+			val[idx] = normalizeTree(val[idx])
+		}
+
+		return val
+	case []map[string]interface{}: // TOML arrays of tables.
+		output := make([]interface{}, len(val))
+		for idx := range val {
+			output[idx] = normalizeTree(val[idx])
+		}
+
+		return output
+	default:
+		return node
+	}
+}
+
+// decodeJSONTree decodes JSON token by token, so duplicate keys are found. Numbers keep their precision.
+// Returns the offset of the last token read, so errors can be found.
+func decodeJSONTree(data []byte) (interface{}, int64, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	tree, err := decodeJSONValue(decoder)
+	if err != nil {
+		return nil, decoder.InputOffset(), err
+	}
+
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, decoder.InputOffset(), ErrTrailingData
+	}
+
+	return tree, -1, nil
+}
+
+// decodeJSONValue decodes the next value from a JSON token stream.
+func decodeJSONValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err //nolint:wrapcheck // The caller wraps it.
+	}
+
+	switch val := token.(type) {
+	case json.Delim:
+		if val == '[' {
+			list := []interface{}{}
+
+			for decoder.More() {
+				item, err := decodeJSONValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+
+				list = append(list, item)
+			}
+
+			_, err = decoder.Token() // ]
+
+			return list, err //nolint:wrapcheck
+		}
+
+		object := map[string]interface{}{}
+
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err //nolint:wrapcheck
+			}
+
+			if _, ok := object[key.(string)]; ok { //nolint:forcetypeassert // Object keys are always strings.
+				return nil, fmt.Errorf("%w: %s", ErrDuplicateKey, key)
+			}
+
+			if object[key.(string)], err = decodeJSONValue(decoder); err != nil { //nolint:forcetypeassert
+				return nil, err
+			}
+		}
+
+		_, err = decoder.Token() // }
+
+		return object, err //nolint:wrapcheck
+	case json.Number:
+		if num, err := val.Int64(); err == nil {
+			return num, nil
+		}
+
+		return val.Float64() //nolint:wrapcheck
+	default:
+		return token, nil // string, bool or nil.
+	}
+}
+
+// decodeXMLTree decodes XML into a generic tree. The root element is removed.
+// Returns the offset of the last token read, so errors can be found.
+func decodeXMLTree(data []byte) (interface{}, int64, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil, -1, nil // Empty file.
+		} else if err != nil {
+			return nil, decoder.InputOffset(), err //nolint:wrapcheck
+		}
+
+		if start, ok := token.(xml.StartElement); ok {
+			tree, err := decodeXMLElement(decoder, start)
+			if err != nil {
+				return nil, decoder.InputOffset(), err
+			}
+
+			if _, ok := tree.(string); ok {
+				return map[string]interface{}{}, -1, nil // Root element without children.
+			}
+
+			return tree, -1, nil
+		}
+	}
+}
+
+// decodeXMLElement decodes an element into a map, or a value if the element has no children or attributes.
+func decodeXMLElement(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	var (
+		children = map[string]interface{}{}
+		lists    = map[string]bool{}
+		text     strings.Builder
+	)
+
+	add := func(name string, value interface{}) {
+		if existing, ok := children[name]; !ok {
+			children[name] = value
+		} else if lists[name] {
+			children[name] = append(existing.([]interface{}), value) //nolint:forcetypeassert
+		} else {
+			lists[name] = true
+			children[name] = []interface{}{existing, value}
+		}
+	}
+
+	for _, attr := range start.Attr {
+		add(attr.Name.Local, xmlValue(attr.Value))
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err //nolint:wrapcheck // The caller wraps it.
+		}
+
+		switch val := token.(type) {
+		case xml.StartElement:
+			child, err := decodeXMLElement(decoder, val)
+			if err != nil {
+				return nil, err
+			}
+
+			add(val.Name.Local, child)
+		case xml.CharData:
+			text.Write(val)
+		case xml.EndElement:
+			if len(children) == 0 {
+				return xmlValue(strings.TrimSpace(text.String())), nil
+			}
+
+			return children, nil
+		}
+	}
+}
+
+// xmlValue converts an XML string into a bool or number, if Go formats it the same way.
+// This keeps values like 0123 and 1.10 as strings.
+func xmlValue(str string) interface{} {
+	if val, err := strconv.ParseBool(str); err == nil && strconv.FormatBool(val) == str {
+		return val
+	}
+
+	if val, err := strconv.ParseInt(str, 10, 64); err == nil && strconv.FormatInt(val, 10) == str { //nolint:mnd
+		return val
+	}
+
+	if val, err := strconv.ParseFloat(str, 64); err == nil && strconv.FormatFloat(val, 'g', -1, 64) == str { //nolint:mnd
+		return val
+	}
+
+	return str
+}
+
+// encodeXML writes a generic tree as indented XML. Slices become repeated elements.
+func encodeXML(buf *bytes.Buffer, name string, node interface{}, depth int) error {
+	if !validXMLName(name) {
+		return fmt.Errorf("%w: %q", ErrXMLName, name)
+	}
+
+	indent := strings.Repeat("  ", depth)
+
+	switch val := node.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+		buf.WriteString(indent + "<" + name + ">\n")
+
+		for _, key := range keys {
+			if err := encodeXML(buf, key, val[key], depth+1); err != nil {
+				return err
+			}
+		}
+
+		buf.WriteString(indent + "</" + name + ">\n")
+	case []interface{}:
+		for _, item := range val {
+			if err := encodeXML(buf, name, item, depth); err != nil {
+				return err
+			}
+		}
+	case nil:
+		buf.WriteString(indent + "<" + name + "/>\n")
+	case time.Time:
+		return encodeXML(buf, name, val.Format(time.RFC3339Nano), depth)
+	default:
+		buf.WriteString(indent + "<" + name + ">")
+
+		if err := xml.EscapeText(buf, []byte(fmt.Sprint(val))); err != nil {
+			return fmt.Errorf("escaping %s: %w", name, err)
+		}
+
+		buf.WriteString("</" + name + ">\n")
+	}
+
+	return nil
+}
+
+// validXMLName returns true if a name can be used as an XML element name without a namespace:
+// it begins with a letter or underscore, and contains only letters, digits, dots, dashes and underscores.
+func validXMLName(name string) bool {
+	for idx, char := range name {
+		switch {
+		case unicode.IsLetter(char) || char == '_':
+		case idx > 0 && (unicode.IsDigit(char) || char == '.' || char == '-'):
+		default:
+			return false
+		}
+	}
+
+	return name != ""
+}
@@ -0,0 +1,127 @@
+package cnfgfile_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+func TestUnmarshalTree(t *testing.T) {
+	t.Parallel()
+
+	var expected []byte
+
+	for _, name := range []string{"config.json", "config.yaml", "config.toml", "config.json.gz", "config.yaml.bz2"} {
+		tree := map[string]interface{}{}
+		loaded, err := cnfgfile.UnmarshalTree(tree, nil, "tests/"+name)
+		require.NoError(t, err, name)
+		assert.Equal(t, []string{"tests/" + name}, loaded)
+
+		// Every format must produce the same tree.
+		output, err := cnfgfile.EncodeTree(tree, cnfgfile.FormatJSON)
+		require.NoError(t, err, name)
+
+		if expected == nil {
+			expected = output
+		}
+
+		assert.JSONEq(t, string(expected), string(output), name)
+	}
+
+	tree := map[string]interface{}{}
+	_, err := cnfgfile.UnmarshalTree(tree, nil, "tests/config.xml")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"pslice":  map[string]interface{}{"bool": true, "float": 123.4567},
+		"sslice":  map[string]interface{}{"string": "foo", "int": int64(123)},
+		"struct":  map[string]interface{}{"bool": false},
+		"pstruct": map[string]interface{}{"string": "foo2"},
+	}, tree, "xml values must be converted to numbers and booleans")
+
+	_, err = cnfgfile.UnmarshalTree(nil, nil, "tests/config.json")
+	require.ErrorIs(t, err, cnfgfile.ErrNotPtr)
+
+	_, err = cnfgfile.UnmarshalTree(map[string]interface{}{}, nil)
+	require.ErrorIs(t, err, cnfgfile.ErrNoFile)
+}
+
+func TestUnmarshalTreeMerge(t *testing.T) {
+	t.Parallel()
+
+	first := writeFile(t, "first.yaml", []byte("a: 1\nmap:\n  b: 2\n  c: 3\nlist: [1, 2]\n"))
+	second := writeFile(t, "second.json", []byte(`{"map": {"c": "x", "d": 4}, "list": [3]}`))
+
+	tree := map[string]interface{}{}
+	loaded, err := cnfgfile.UnmarshalTree(tree, nil, first, cnfgfile.OptionalPrefix+"/no_file.toml", second)
+	require.NoError(t, err)
+	assert.Equal(t, []string{first, second}, loaded)
+	assert.Equal(t, map[string]interface{}{
+		"a":    1,
+		"map":  map[string]interface{}{"b": 2, "c": "x", "d": int64(4)},
+		"list": []interface{}{int64(3)},
+	}, tree, "maps must be merged, other values replaced")
+}
+
+func TestUnmarshalTreeErrors(t *testing.T) {
+	t.Parallel()
+
+	for name, test := range map[string]struct {
+		data   string
+		line   int
+		column int
+		is     error
+	}{
+		"dup.json":      {data: "{\n  \"a\": 1,\n  \"a\": 2\n}", line: 3, column: 6, is: cnfgfile.ErrDuplicateKey},
+		"syntax.json":   {data: "{\n  \"a\": 1,\n}", line: 3, column: 1},
+		"trailing.json": {data: "{}\n{}", line: 2, column: 2, is: cnfgfile.ErrTrailingData},
+		"dup.yaml":      {data: "a: 1\nb: 2\na: 3\n", line: 3},
+		"bad.toml":      {data: "a = 1\nb = \n", line: 2, column: 5},
+		"bad.xml":       {data: "<config>\n<a>1</b>\n</config>", line: 2},
+		"list.yaml":     {data: "- a\n- b\n"},
+	} {
+		_, err := cnfgfile.UnmarshalTree(map[string]interface{}{}, nil, writeFile(t, name, []byte(test.data)))
+
+		var syntaxErr *cnfgfile.SyntaxError
+
+		require.ErrorAs(t, err, &syntaxErr, name)
+		assert.Equal(t, test.line, syntaxErr.Line, name)
+		assert.Equal(t, test.column, syntaxErr.Column, name)
+
+		if test.is != nil {
+			require.ErrorIs(t, err, test.is, name)
+		}
+	}
+}
+
+func TestEncodeTree(t *testing.T) {
+	t.Parallel()
+
+	tree := map[string]interface{}{}
+	_, err := cnfgfile.UnmarshalTree(tree, nil, "tests/config.yaml")
+	require.NoError(t, err)
+
+	// Every format must unmarshal back into the config struct.
+	for _, format := range []string{cnfgfile.FormatJSON, cnfgfile.FormatYAML, cnfgfile.FormatTOML, cnfgfile.FormatXML} {
+		data, err := cnfgfile.EncodeTree(tree, format)
+		require.NoError(t, err, format)
+
+		config := &testStruct{}
+		err = cnfgfile.Unmarshal(config, writeFile(t, "config."+format, data))
+		testUnmarshalValues(t, assert.New(t), config, err, format)
+	}
+
+	_, err = cnfgfile.EncodeTree(tree, "ini")
+	require.Error(t, err)
+
+	for _, key := range []string{"a b", "1st", "a><script", "", "ns:key"} {
+		_, err = cnfgfile.EncodeTree(map[string]interface{}{"ok": map[string]interface{}{key: "x"}}, cnfgfile.FormatXML)
+		require.ErrorIs(t, err, cnfgfile.ErrXMLName, key)
+	}
+
+	data, err := cnfgfile.EncodeTree(map[string]interface{}{"_a.b-1": "<&>", "ключ": 1}, cnfgfile.FormatXML)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "<_a.b-1>&lt;&amp;&gt;</_a.b-1>")
+	assert.Contains(t, string(data), "<ключ>1</ключ>")
+}
@@ -0,0 +1,331 @@
+package cnfgfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ValidateTag is the struct tag Validate() reads rules from.
+// Rules are separated by commas, ie. `validate:"required,min=1,max=10"`.
+// The regexp rule consumes the rest of the tag, so it must be last if the expression contains a comma.
+const ValidateTag = "validate"
+
+// Errors returned (wrapped in an ElemError) by Validate().
+var (
+	ErrRequired    = errors.New("required value is missing")
+	ErrBelowMin    = errors.New("value is below minimum")
+	ErrAboveMax    = errors.New("value is above maximum")
+	ErrNotOneOf    = errors.New("value is not one of the allowed values")
+	ErrNoMatch     = errors.New("value does not match expression")
+	ErrFileMissing = errors.New("file does not exist")
+	ErrInvalidRule = errors.New("invalid validation rule")
+)
+
+// Validator is an optional interface a struct (or any other type) may satisfy.
+// Validate() calls this method on every element that implements it, at any depth.
+// Return an error to report a custom violation; it's wrapped in an ElemError.
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError is returned by Validate() when one or more elements fail validation.
+// Every violation is included. Use errors.As() to make this data available in your application.
+type ValidationError struct {
+	// Errors contains one element failure per failed rule or Validator.
+	Errors []*ElemError
+}
+
+// Error satisfies the standard Go library error interface.
+func (v *ValidationError) Error() string {
+	msgs := make([]string, len(v.Errors))
+	for idx, err := range v.Errors {
+		msgs[idx] = err.Error()
+	}
+
+	return fmt.Sprintf("validation failed with %d error(s): %s", len(v.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap is used to make the custom error work with errors.Is and errors.As.
+func (v *ValidationError) Unwrap() []error {
+	errs := make([]error, len(v.Errors))
+	for idx, err := range v.Errors {
+		errs[idx] = err
+	}
+
+	return errs
+}
+
+// Validate checks a data structure after it's been unmarshaled (and optionally Parse'd).
+// It recurses the same way Parse does, and does two things with every element:
+// 1. If the element satisfies the Validator interface, its Validate() method is called.
+// 2. If the element is a struct member with a `validate` tag, the rules in the tag are checked.
+// Supported rules: required, min=N, max=N, oneof=a b c, regexp=expr, file_exists.
+// min and max compare numbers and Durations by value, and strings, slices and maps by length.
+// All violations are returned at once in a ValidationError. Element names match Parse's naming scheme.
+// Only Opts.Name and Opts.MaxDepth are used; opts may be nil.
+func Validate(ptr interface{}, opts *Opts) error {
+	if ptr == nil || reflect.TypeOf(ptr).Kind() != reflect.Ptr {
+		return ErrNotPtr
+	}
+
+	valid := &validator{parser: opts.newParser()}
+	valid.validate(reflect.ValueOf(ptr), valid.Name)
+
+	if len(valid.Errors) > 0 {
+		return &ValidationError{Errors: valid.Errors}
+	}
+
+	return nil
+}
+
+// validator walks a data structure and collects violations.
+type validator struct {
+	*parser
+	// Errors is the list of violations found so far.
+	Errors []*ElemError
+}
+
+// addError saves a violation.
+func (v *validator) addError(name, file string, err error) {
+	v.Errors = append(v.Errors, &ElemError{Name: name, File: file, Inner: err})
+}
+
+// validate calls the Validator interface, and recurses into the element.
+func (v *validator) validate(elem reflect.Value, name string) {
+	v.CurrentDepth++
+	defer func() { v.CurrentDepth-- }()
+
+	if v.CurrentDepth > v.MaxDepth || !elem.IsValid() {
+		return
+	}
+
+	switch elem.Kind() { //nolint:exhaustive // Other kinds have nothing to recurse.
+	case reflect.Pointer, reflect.Interface:
+		if !elem.IsNil() {
+			v.validate(elem.Elem(), name)
+		}
+
+		return // Do not call Validate() twice for the same element.
+	case reflect.Struct:
+		v.validateStruct(elem, name)
+	case reflect.Slice, reflect.Array:
+		for idx := 0; idx < elem.Len(); idx++ {
+			v.validate(elem.Index(idx), fmt.Sprintf("%s[%d/%d]", name, idx+1, elem.Len()))
+		}
+	case reflect.Map:
+		for _, key := range elem.MapKeys() {
+			// Copy the map value so it's addressable and pointer-receiver Validate() methods are found.
+			elemCopy := reflect.New(elem.MapIndex(key).Type()).Elem()
+			elemCopy.Set(elem.MapIndex(key))
+			v.validate(elemCopy, fmt.Sprint(name, "[", key, "]"))
+		}
+	}
+
+	v.callValidator(elem, name)
+}
+
+// callValidator runs the Validate() method if the element (or a pointer to it) has one.
+func (v *validator) callValidator(elem reflect.Value, name string) {
+	var iface interface{}
+
+	switch {
+	case elem.CanAddr() && elem.Addr().CanInterface():
+		iface = elem.Addr().Interface()
+	case elem.CanInterface():
+		iface = elem.Interface()
+	default:
+		return
+	}
+
+	if validator, ok := iface.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			v.addError(name, "", err)
+		}
+	}
+}
+
+// validateStruct checks the tag rules on every exported member, and recurses into each one.
+// Promoted fields are skipped, they're validated when their embedded struct is.
+func (v *validator) validateStruct(elem reflect.Value, name string) {
+	for _, field := range reflect.VisibleFields(elem.Type()) {
+		if !field.IsExported() || len(field.Index) > 1 {
+			continue
+		}
+
+		member := elem.FieldByIndex(field.Index)
+		memberName := name + "." + field.Name
+		v.CurrentElement = memberName
+
+		if tag := field.Tag.Get(ValidateTag); tag != "" {
+			v.checkRules(member, memberName, tag)
+		}
+
+		v.validate(member, memberName)
+	}
+}
+
+// checkRules runs every rule in a validate tag against an element.
+func (v *validator) checkRules(elem reflect.Value, name, tag string) {
+	for tag != "" {
+		var rule string
+
+		rule, tag, _ = strings.Cut(tag, ",")
+		rule = strings.TrimSpace(rule)
+
+		if strings.HasPrefix(rule, "regexp=") && tag != "" {
+			rule, tag = rule+","+tag, "" // Regular expressions may contain commas.
+		}
+
+		if err := checkRule(elem, rule); err != nil {
+			v.addError(name, fileFromRule(elem, rule), err)
+		}
+	}
+}
+
+// fileFromRule returns the file name for a failed file_exists rule, so it's included in the ElemError.
+func fileFromRule(elem reflect.Value, rule string) string {
+	if rule == "file_exists" && elem.Kind() == reflect.String {
+		return elem.String()
+	}
+
+	return ""
+}
+
+// checkRule checks a single rule against an element.
+func checkRule(elem reflect.Value, rule string) error {
+	rule, arg, _ := strings.Cut(rule, "=")
+
+	if rule == "required" {
+		if elem.IsZero() || (isLenKind(elem.Kind()) && elem.Len() == 0) {
+			return ErrRequired
+		}
+
+		return nil
+	}
+
+	// Nil pointers are only checked by required, all other rules apply to values.
+	for elem.Kind() == reflect.Pointer || elem.Kind() == reflect.Interface {
+		if elem.IsNil() {
+			return nil
+		}
+
+		elem = elem.Elem()
+	}
+
+	switch rule {
+	case "min", "max":
+		return checkMinMax(elem, rule, arg)
+	case "oneof":
+		return checkOneOf(elem, arg)
+	case "regexp":
+		return checkRegexp(elem, arg)
+	case "file_exists":
+		return checkFileExists(elem)
+	case "":
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown rule '%s'", ErrInvalidRule, rule)
+	}
+}
+
+// isLenKind returns true for kinds that min/max treat as a length.
+func isLenKind(kind reflect.Kind) bool {
+	return kind == reflect.String || kind == reflect.Slice || kind == reflect.Map || kind == reflect.Array
+}
+
+// checkMinMax compares numbers, durations and lengths against a limit.
+func checkMinMax(elem reflect.Value, rule, arg string) error {
+	value, limit, err := compareValues(elem, arg)
+	if err != nil {
+		return fmt.Errorf("%w: %s=%s: %v", ErrInvalidRule, rule, arg, err)
+	}
+
+	switch {
+	case rule == "min" && value < limit:
+		return fmt.Errorf("%w: %s", ErrBelowMin, arg)
+	case rule == "max" && value > limit:
+		return fmt.Errorf("%w: %s", ErrAboveMax, arg)
+	default:
+		return nil
+	}
+}
+
+// compareValues returns the element's value (or length) and the parsed argument as comparable floats.
+func compareValues(elem reflect.Value, arg string) (float64, float64, error) {
+	if dur, ok := elem.Interface().(durationer); ok {
+		limit, err := ParseDuration(arg)
+		return float64(dur.duration()), float64(limit), err //nolint:wrapcheck // It gets wrapped.
+	}
+
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return 0, 0, err //nolint:wrapcheck // It gets wrapped.
+	}
+
+	switch kind := elem.Kind(); {
+	case isLenKind(kind):
+		return float64(elem.Len()), limit, nil
+	case elem.CanInt():
+		return float64(elem.Int()), limit, nil
+	case elem.CanUint():
+		return float64(elem.Uint()), limit, nil
+	case elem.CanFloat():
+		return elem.Float(), limit, nil
+	default:
+		return 0, 0, fmt.Errorf("%w: unsupported type %s", ErrInvalidRule, elem.Type())
+	}
+}
+
+// checkOneOf makes sure an element's value is in a space-separated list.
+func checkOneOf(elem reflect.Value, arg string) error {
+	value := fmt.Sprint(elem.Interface())
+
+	for _, allowed := range strings.Fields(arg) {
+		if value == allowed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrNotOneOf, arg)
+}
+
+// checkRegexp makes sure a string matches a regular expression.
+func checkRegexp(elem reflect.Value, arg string) error {
+	if elem.Kind() != reflect.String {
+		return fmt.Errorf("%w: regexp: unsupported type %s", ErrInvalidRule, elem.Type())
+	}
+
+	expr, err := regexp.Compile(arg)
+	if err != nil {
+		return fmt.Errorf("%w: regexp: %v", ErrInvalidRule, err)
+	}
+
+	if !expr.MatchString(elem.String()) {
+		return fmt.Errorf("%w: %s", ErrNoMatch, arg)
+	}
+
+	return nil
+}
+
+// checkFileExists makes sure a string is the path to an existing file (or directory).
+// Empty strings are skipped; combine with required if they are not allowed.
+func checkFileExists(elem reflect.Value) error {
+	if elem.Kind() != reflect.String {
+		return fmt.Errorf("%w: file_exists: unsupported type %s", ErrInvalidRule, elem.Type())
+	}
+
+	if elem.String() == "" {
+		return nil
+	}
+
+	if _, err := os.Stat(elem.String()); err != nil {
+		return fmt.Errorf("%w: %v", ErrFileMissing, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package cnfgfile_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golift.io/cnfgfile"
+)
+
+var errTestValidator = errors.New("port and address conflict")
+
+type validateStruct struct {
+	Name     string            `validate:"required"`
+	Level    string            `validate:"oneof=debug info error"`
+	Port     int               `validate:"min=1,max=65535"`
+	Ratio    *float64          `validate:"max=1"`
+	Tags     []string          `validate:"min=1"`
+	Interval cnfgfile.Duration `validate:"min=1s,max=1h"`
+	Host     string            `validate:"regexp=^[a-z]{2,5}$"`
+	KeyFile  string            `validate:"file_exists"`
+	Sub      *validateSub      `validate:"required"`
+	Subs     []validateSub
+	SubMap   map[string]validateSub
+}
+
+type validateSub struct {
+	Address string `validate:"required"`
+	Port    uint   `validate:"max=10"`
+}
+
+func (v *validateSub) Validate() error {
+	if v.Port == 1 && v.Address == "one" {
+		return errTestValidator
+	}
+
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	file := makeTextFile(t)
+	defer os.Remove(file)
+
+	ratio := 0.5
+	data := &validateStruct{
+		Name:     "me",
+		Level:    "info",
+		Port:     80,
+		Ratio:    &ratio,
+		Tags:     []string{"one"},
+		Interval: cnfgfile.Duration{Duration: time.Minute},
+		Host:     "abc",
+		KeyFile:  file,
+		Sub:      &validateSub{Address: "addr"},
+		Subs:     []validateSub{{Address: "addr"}},
+		SubMap:   map[string]validateSub{"key": {Address: "addr"}},
+	}
+
+	require.NoError(t, cnfgfile.Validate(data, nil))
+	require.ErrorIs(t, cnfgfile.Validate(*data, nil), cnfgfile.ErrNotPtr)
+}
+
+func TestValidateErrors(t *testing.T) {
+	t.Parallel()
+
+	ratio := 1.5
+	data := &validateStruct{
+		Level:    "trace",
+		Port:     70000,
+		Ratio:    &ratio,
+		Interval: cnfgfile.Duration{Duration: time.Millisecond},
+		Host:     "a,b",
+		KeyFile:  "/no_file",
+		Subs:     []validateSub{{Address: "addr"}, {Address: "one", Port: 1}},
+		SubMap:   map[string]validateSub{"key": {Port: 11}},
+	}
+
+	err := cnfgfile.Validate(data, &cnfgfile.Opts{Name: "MyThing"})
+
+	var valErr *cnfgfile.ValidationError
+	require.ErrorAs(t, err, &valErr)
+
+	failed := map[string]error{}
+	for _, elemErr := range valErr.Errors {
+		failed[elemErr.Name] = elemErr.Inner
+	}
+
+	assert.Len(t, failed, 12, "the wrong number of violations was returned")
+	require.ErrorIs(t, err, cnfgfile.ErrRequired)
+	require.ErrorIs(t, err, errTestValidator)
+	require.ErrorContains(t, err, "element failure: MyThing.KeyFile: file does not exist")
+	assert.ErrorIs(t, failed["MyThing.Name"], cnfgfile.ErrRequired)
+	assert.ErrorIs(t, failed["MyThing.Level"], cnfgfile.ErrNotOneOf)
+	assert.ErrorIs(t, failed["MyThing.Port"], cnfgfile.ErrAboveMax)
+	assert.ErrorIs(t, failed["MyThing.Ratio"], cnfgfile.ErrAboveMax)
+	assert.ErrorIs(t, failed["MyThing.Tags"], cnfgfile.ErrBelowMin)
+	assert.ErrorIs(t, failed["MyThing.Interval"], cnfgfile.ErrBelowMin)
+	assert.ErrorIs(t, failed["MyThing.Host"], cnfgfile.ErrNoMatch)
+	assert.ErrorIs(t, failed["MyThing.Sub"], cnfgfile.ErrRequired)
+	assert.ErrorIs(t, failed["MyThing.Subs[2/2]"], errTestValidator)
+	assert.ErrorIs(t, failed["MyThing.SubMap[key].Address"], cnfgfile.ErrRequired)
+	assert.ErrorIs(t, failed["MyThing.SubMap[key].Port"], cnfgfile.ErrAboveMax)
+}
+
+func TestValidateInvalidRule(t *testing.T) {
+	t.Parallel()
+
+	data := &struct {
+		Name  string `validate:"bogus"`
+		Count int    `validate:"min=one"`
+		Flag  bool   `validate:"regexp=^t"`
+	}{}
+
+	err := cnfgfile.Validate(data, nil)
+
+	var valErr *cnfgfile.ValidationError
+	require.ErrorAs(t, err, &valErr)
+	assert.Len(t, valErr.Errors, 3)
+
+	for _, elemErr := range valErr.Errors {
+		require.ErrorIs(t, elemErr, cnfgfile.ErrInvalidRule)
+	}
+}
+
+func TestValidateDurationUnits(t *testing.T) {
+	t.Parallel()
+
+	data := &struct {
+		Retention cnfgfile.Duration `validate:"min=1d,max=2w"`
+	}{Retention: cnfgfile.Duration{Duration: 3 * cnfgfile.Day}}
+
+	require.NoError(t, cnfgfile.Validate(data, nil), "day and week rules must be parsed")
+
+	data.Retention.Duration = 3 * cnfgfile.Week
+	require.ErrorIs(t, cnfgfile.Validate(data, nil), cnfgfile.ErrAboveMax)
+
+	data.Retention.Duration = time.Hour
+	require.ErrorIs(t, cnfgfile.Validate(data, nil), cnfgfile.ErrBelowMin)
+}